@@ -0,0 +1,220 @@
+package mapstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// DefaultChunkSize leaves room for the ConfigMap metadata when a chunk is stored on its own.
+const DefaultChunkSize = 900 * 1024
+
+// chunkHeader marks a value that is a manifest of a chunked value, and is followed by the manifest as JSON.
+var chunkHeader = []byte("\x00msc")
+
+// chunkKey is the key that holds the data in a chunk ConfigMap.
+const chunkKey = "chunk"
+
+// chunkIDSize is the number of random bytes in the name of a chunk ConfigMap.
+const chunkIDSize = 8
+
+// chunkNameSuffix is the length of what is added to the ConfigMap name to name a chunk: "-chunk-", the random ID, "-"
+// and the index. A manifest that lists 100000 chunk names can't fit in a ConfigMap, so five digits are enough.
+const chunkNameSuffix = len("-chunk-") + 2*chunkIDSize + len("-") + 5
+
+// chunkManifest is stored under the key of a chunked value, and lists the ConfigMaps that hold its chunks in order.
+type chunkManifest struct {
+	Size   int      `json:"size"`
+	SHA256 string   `json:"sha256"`
+	Chunks []string `json:"chunks"`
+}
+
+// chunkCache holds reassembled values by checksum, so chunks are not fetched again for every read or write. Entries
+// can never go stale as they are keyed by the checksum of the value.
+type chunkCache struct {
+	*sync.Mutex
+	values map[string][]byte
+}
+
+func newChunkCache() *chunkCache {
+	return &chunkCache{&sync.Mutex{}, map[string][]byte{}}
+}
+
+func (c *chunkCache) get(sum string) ([]byte, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	val, ok := c.values[sum]
+	return val, ok
+}
+
+func (c *chunkCache) set(sum string, value []byte) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.values[sum] = value
+}
+
+// keep removes every entry that is not referenced by the given stored data.
+func (c *chunkCache) keep(stored map[string][]byte) {
+	c.Lock()
+	defer c.Unlock()
+
+	referenced := map[string]bool{}
+	for _, value := range stored {
+		if m, ok := parseManifest(value); ok {
+			referenced[m.SHA256] = true
+		}
+	}
+
+	for sum := range c.values {
+		if !referenced[sum] {
+			delete(c.values, sum)
+		}
+	}
+}
+
+// validateChunkName returns an error if the names of the chunk ConfigMaps would be too long for the API server.
+func validateChunkName(cmName string) error {
+	if max := validation.DNS1123SubdomainMaxLength - chunkNameSuffix; len(cmName) > max {
+		return fmt.Errorf("name %q is too long to use chunking, it can be at most %d characters", cmName, max)
+	}
+
+	return nil
+}
+
+// parseManifest returns the manifest if the stored value is one.
+func parseManifest(value []byte) (*chunkManifest, bool) {
+	if !bytes.HasPrefix(value, chunkHeader) {
+		return nil, false
+	}
+
+	var m chunkManifest
+	if err := json.Unmarshal(value[len(chunkHeader):], &m); err != nil {
+		return nil, false
+	}
+
+	return &m, true
+}
+
+// writeChunks stores the value in new chunk objects and returns the manifest to store in its place. The chunk names
+// contain a random ID, so no two writes ever share a chunk, even when another writer stores the same value under the
+// same key. The caller must hold the write lock.
+func (k *Manager) writeChunks(ctx context.Context, value []byte) ([]byte, error) {
+	id := make([]byte, chunkIDSize)
+	if _, err := io.ReadFull(rand.Reader, id); err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(value)
+	m := chunkManifest{Size: len(value), SHA256: hex.EncodeToString(sum[:])}
+
+	for i := 0; i*k.chunkSize < len(value); i++ {
+		end := (i + 1) * k.chunkSize
+		if end > len(value) {
+			end = len(value)
+		}
+
+		name := k.configMapName + "-chunk-" + hex.EncodeToString(id) + "-" + strconv.Itoa(i)
+		k.chunksWritten = append(k.chunksWritten, name)
+
+		if _, err := k.store.create(ctx, name, map[string][]byte{chunkKey: value[i*k.chunkSize : end]}); err != nil {
+			return nil, err
+		}
+
+		m.Chunks = append(m.Chunks, name)
+	}
+
+	raw, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+
+	k.chunks.set(m.SHA256, value)
+
+	return append(append([]byte{}, chunkHeader...), raw...), nil
+}
+
+// readChunks reassembles a chunked value and verifies its checksum.
+func (k *Manager) readChunks(ctx context.Context, m *chunkManifest) ([]byte, error) {
+	if val, ok := k.chunks.get(m.SHA256); ok {
+		return val, nil
+	}
+
+	value := make([]byte, 0, m.Size)
+	for _, name := range m.Chunks {
+		obj, err := k.store.get(ctx, name)
+		if err != nil {
+			return nil, fmt.Errorf("reading chunk %s: %w", name, err)
+		}
+
+		value = append(value, obj.getData()[chunkKey]...)
+	}
+
+	if sum := sha256.Sum256(value); len(value) != m.Size || hex.EncodeToString(sum[:]) != m.SHA256 {
+		return nil, fmt.Errorf("chunked value does not match its checksum")
+	}
+
+	k.chunks.set(m.SHA256, value)
+
+	return value, nil
+}
+
+// cleanupChunks removes the chunk ConfigMaps that are no longer needed after a mutation. If the mutation was committed,
+// those are the chunks referenced by the data it replaced or written by it, but not referenced by the committed data.
+// Otherwise only the chunks written by the mutation are removed, and only if the data on the server does not reference
+// them, as the write may have landed after all. This is best effort, as the write itself already happened or failed.
+func (k *Manager) cleanupChunks(ctx context.Context, committed bool, old, current map[string][]byte) {
+	candidates := map[string]bool{}
+	for _, name := range k.chunksWritten {
+		candidates[name] = true
+	}
+
+	k.chunksWritten = nil
+
+	if committed {
+		for name := range chunkNames(old) {
+			candidates[name] = true
+		}
+	} else if len(candidates) == 0 {
+		return
+	} else if obj, err := k.store.get(ctx, k.configMapName); err == nil {
+		current = obj.getData()
+	} else if isNotFound(err) {
+		current = map[string][]byte{}
+	} else {
+		return
+	}
+
+	referenced := chunkNames(current)
+
+	for name := range candidates {
+		if !referenced[name] {
+			_ = k.store.delete(ctx, name)
+		}
+	}
+
+	k.chunks.keep(current)
+}
+
+func chunkNames(stored map[string][]byte) map[string]bool {
+	names := map[string]bool{}
+	for _, value := range stored {
+		if m, ok := parseManifest(value); ok {
+			for _, name := range m.Chunks {
+				names[name] = true
+			}
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,207 @@
+package mapstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func chunkConfigMaps(t *testing.T, client *fake.Clientset) []string {
+	t.Helper()
+
+	list, err := client.CoreV1().ConfigMaps(storeTestNamespace).List(context.Background(), v1.ListOptions{})
+	assert.NoError(t, err)
+
+	var names []string
+	for _, cm := range list.Items {
+		if _, ok := cm.BinaryData[chunkKey]; ok {
+			names = append(names, cm.Name)
+		}
+	}
+
+	return names
+}
+
+func TestChunkRoundTrip(t *testing.T) {
+	client := setFakeKubeClient(t)
+
+	kv, err := NewWithOptions(storeTestName, WithCache(true), WithChunking(10))
+	assert.NoError(t, err)
+
+	big := []byte("abcdefghijklmnopqrstuvwxyz0123456789")
+	assert.NoError(t, kv.Set("big", big))
+	assert.NoError(t, kv.Set("small", []byte("tiny")))
+
+	// Only a manifest is stored under the key.
+	assert.True(t, bytes.HasPrefix(kv.internalCache["big"], chunkHeader))
+	assert.Equal(t, []byte("tiny"), kv.internalCache["small"])
+	assert.Len(t, chunkConfigMaps(t, client), 4)
+
+	val, err := kv.Get("big")
+	assert.NoError(t, err)
+	assert.Equal(t, big, val)
+
+	keys, err := kv.Keys()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"big", "small"}, keys)
+
+	// A Manager without chunking enabled can still read it.
+	other, err := New(storeTestName, false)
+	assert.NoError(t, err)
+
+	raw, err := other.Raw()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"big": big, "small": []byte("tiny")}, raw)
+}
+
+func TestChunkCleanup(t *testing.T) {
+	client := setFakeKubeClient(t)
+
+	kv, err := NewWithOptions(storeTestName, WithChunking(10))
+	assert.NoError(t, err)
+
+	// Overwriting replaces the chunks.
+	assert.NoError(t, kv.Set("big", bytes.Repeat([]byte("a"), 25)))
+	first := chunkConfigMaps(t, client)
+	assert.Len(t, first, 3)
+
+	assert.NoError(t, kv.Set("big", bytes.Repeat([]byte("b"), 15)))
+	second := chunkConfigMaps(t, client)
+	assert.Len(t, second, 2)
+	assert.NotSubset(t, second, first)
+
+	// Deleting removes them.
+	assert.NoError(t, kv.Delete("big"))
+	assert.Empty(t, chunkConfigMaps(t, client))
+
+	// And so does truncating.
+	assert.NoError(t, kv.SetMany(map[string][]byte{"k1": bytes.Repeat([]byte("c"), 15), "k2": bytes.Repeat([]byte("d"), 15)}))
+	assert.Len(t, chunkConfigMaps(t, client), 4)
+	assert.NoError(t, kv.Truncate())
+	assert.Empty(t, chunkConfigMaps(t, client))
+}
+
+func TestChunkReshardCleanup(t *testing.T) {
+	client := setFakeKubeClient(t)
+
+	kv, err := NewSharded(storeTestName, 3, WithChunking(16))
+	assert.NoError(t, err)
+
+	for i := 0; i < 6; i++ {
+		assert.NoError(t, kv.Set(fmt.Sprintf("key-%d", i), bytes.Repeat([]byte{byte('a' + i)}, 40)))
+	}
+	before := chunkConfigMaps(t, client)
+	assert.Len(t, before, 18)
+
+	// The chunks of the removed shards go with them.
+	assert.NoError(t, kv.Reshard(1))
+
+	kc := &kubeClient{client, context.Background(), storeTestNamespace}
+	removed := 0
+	for _, name := range before {
+		if !strings.HasPrefix(name, storeTestName+"-0-") {
+			_, err := kc.getConfigMap(kc.ctx, name)
+			assert.True(t, isNotFound(err), name)
+			removed++
+		}
+	}
+	assert.NotZero(t, removed)
+
+	// Every chunk that is left belongs to a value of the remaining shard.
+	stored, err := kc.get(kc.ctx, storeTestName+"-0")
+	assert.NoError(t, err)
+
+	after := chunkConfigMaps(t, client)
+	assert.Len(t, after, 18)
+	for _, name := range after {
+		assert.True(t, chunkNames(stored)[name], name)
+	}
+
+	raw, err := kv.Raw()
+	assert.NoError(t, err)
+	assert.Len(t, raw, 6)
+}
+
+func TestChunkConflictingWriterSameValue(t *testing.T) {
+	client := setFakeKubeClient(t)
+
+	// The cache of this Manager is behind the other writer.
+	kv, err := NewWithOptions(storeTestName, WithCache(true), WithChunking(10))
+	assert.NoError(t, err)
+
+	other, err := NewWithOptions(storeTestName, WithChunking(10))
+	assert.NoError(t, err)
+
+	big := bytes.Repeat([]byte("a"), 25)
+	assert.NoError(t, other.Set("big", big))
+	committed := chunkConfigMaps(t, client)
+	assert.Len(t, committed, 3)
+
+	// Writing the same value fails after its chunks were stored.
+	client.PrependReactor("update", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.(k8stesting.UpdateAction).GetObject().(*corev1.ConfigMap).Name != storeTestName {
+			return false, nil, nil
+		}
+
+		return true, nil, errors.NewInternalError(fmt.Errorf("write failed"))
+	})
+
+	assert.Error(t, kv.Set("big", big))
+
+	// Only the chunks of the failed write are removed, so the committed value still reads back.
+	assert.ElementsMatch(t, committed, chunkConfigMaps(t, client))
+
+	fresh, err := NewWithOptions(storeTestName, WithChunking(10))
+	assert.NoError(t, err)
+
+	val, err := fresh.Get("big")
+	assert.NoError(t, err)
+	assert.Equal(t, big, val)
+}
+
+func TestChunkNameTooLong(t *testing.T) {
+	setFakeKubeClient(t)
+
+	// The chunk names add to the name of the ConfigMap, and must stay within the limit of the API server.
+	name := strings.Repeat("a", 253-chunkNameSuffix)
+	_, err := NewWithOptions(name, WithChunking(10))
+	assert.NoError(t, err)
+
+	_, err = NewWithOptions(name+"a", WithChunking(10))
+	assert.Error(t, err)
+
+	_, err = NewWithOptions(name + "a")
+	assert.NoError(t, err)
+}
+
+func TestChunkChecksumMismatch(t *testing.T) {
+	client := setFakeKubeClient(t)
+
+	kv, err := NewWithOptions(storeTestName, WithChunking(10))
+	assert.NoError(t, err)
+	assert.NoError(t, kv.Set("big", bytes.Repeat([]byte("a"), 15)))
+
+	// Tamper with the chunks.
+	names := chunkConfigMaps(t, client)
+	assert.Len(t, names, 2)
+	for _, name := range names {
+		assert.NoError(t, kv.client.set(kv.ctx, name, map[string][]byte{chunkKey: []byte("zzzzz")}))
+	}
+
+	// A fresh Manager has nothing in memory to fall back on.
+	other, err := NewWithOptions(storeTestName, WithChunking(10))
+	assert.NoError(t, err)
+
+	_, err = other.Get("big")
+	assert.Error(t, err)
+}
@@ -0,0 +1,97 @@
+package mapstore
+
+import (
+	"bytes"
+	"context"
+)
+
+// encodeValue turns a value into the form that is stored in the ConfigMap: it is compressed, encrypted and then split
+// into chunks if it is still too large. The caller must hold the write lock.
+func (k *Manager) encodeValue(ctx context.Context, key string, value []byte) ([]byte, error) {
+	// A plain value that starts like an encoded one is compressed even if compression is off, or it would be misread.
+	compressor := k.compressor
+	if compressor == nil && hasEncodedHeader(value) {
+		compressor = Gzip
+	}
+
+	var err error
+	if compressor != nil {
+		if value, err = compress(compressor, value); err != nil {
+			return nil, err
+		}
+	}
+
+	if k.keyProvider != nil {
+		if value, err = k.encrypt(ctx, key, value); err != nil {
+			return nil, err
+		}
+	}
+
+	if k.chunkSize > 0 && len(value) > k.chunkSize {
+		return k.writeChunks(ctx, value)
+	}
+
+	return value, nil
+}
+
+// decodeValue reverses encodeValue for a value read from the ConfigMap under the given key.
+func (k *Manager) decodeValue(ctx context.Context, key string, value []byte) ([]byte, error) {
+	var err error
+	if m, ok := parseManifest(value); ok {
+		if value, err = k.readChunks(ctx, m); err != nil {
+			return nil, err
+		}
+	}
+
+	if value, err = k.decrypt(ctx, key, value); err != nil {
+		return nil, err
+	}
+
+	return decompress(k.compressor, value)
+}
+
+// hasEncodedHeader reports if the value starts with one of the headers that decodeValue looks for.
+func hasEncodedHeader(value []byte) bool {
+	return bytes.HasPrefix(value, compressionHeader) || bytes.HasPrefix(value, encryptionHeader) ||
+		bytes.HasPrefix(value, chunkHeader)
+}
+
+// decodeData decodes every stored value. If lenient is set, values that fail to decode are kept as they are stored
+// instead of failing, so they can be carried over untouched by a write to other keys.
+func (k *Manager) decodeData(ctx context.Context, stored map[string][]byte, lenient bool) (map[string][]byte, error) {
+	data := make(map[string][]byte, len(stored))
+	for key, value := range stored {
+		decoded, err := k.decodeValue(ctx, key, value)
+		if err != nil && !lenient {
+			return nil, err
+		} else if err != nil {
+			decoded = value
+		}
+
+		data[key] = decoded
+	}
+
+	return data, nil
+}
+
+// encodeData returns the data to store for the decoded data. Values that are the same as in original (the decoded form
+// of stored) keep their stored form, so unchanged values are not encoded again. Pass a nil original to encode every
+// value.
+func (k *Manager) encodeData(ctx context.Context, stored, original, data map[string][]byte) (map[string][]byte, error) {
+	result := make(map[string][]byte, len(data))
+	for key, value := range data {
+		if ogValue, ok := original[key]; ok && bytes.Equal(ogValue, value) {
+			result[key] = stored[key]
+			continue
+		}
+
+		encoded, err := k.encodeValue(ctx, key, value)
+		if err != nil {
+			return nil, err
+		}
+
+		result[key] = encoded
+	}
+
+	return result, nil
+}
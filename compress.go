@@ -0,0 +1,105 @@
+package mapstore
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+)
+
+// compressionHeader marks the start of a compressed value and is followed by the ID of the Compressor that was used.
+// Values without the header are returned as is, so existing data keeps working when compression is turned on.
+var compressionHeader = []byte("\x00msz")
+
+// Compressor compresses values before they are written to the ConfigMap. Other algorithms (such as zstd) can be
+// plugged in by implementing this interface and passing it to WithCompression.
+type Compressor interface {
+	// ID is stored in the header of every value compressed by the Compressor, and must be unique among the
+	// compressors in use. IDs below 16 are reserved for this package.
+	ID() byte
+	Compress(value []byte) ([]byte, error)
+	Decompress(value []byte) ([]byte, error)
+}
+
+// Gzip is a Compressor that uses gzip with the default compression level.
+var Gzip Compressor = NewGzip(gzip.DefaultCompression)
+
+// builtinCompressors can always be read, even if compression is not enabled for the Manager.
+var builtinCompressors = map[byte]Compressor{Gzip.ID(): Gzip}
+
+type gzipCompressor struct {
+	level int
+}
+
+// NewGzip returns a Compressor that uses gzip with the given compression level.
+func NewGzip(level int) Compressor {
+	return &gzipCompressor{level}
+}
+
+func (g *gzipCompressor) ID() byte {
+	return 1
+}
+
+func (g *gzipCompressor) Compress(value []byte) ([]byte, error) {
+	var buf bytes.Buffer
+
+	w, err := gzip.NewWriterLevel(&buf, g.level)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := w.Write(value); err != nil {
+		return nil, err
+	}
+
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (g *gzipCompressor) Decompress(value []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(value))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// compress returns the compressed value with its header, or the original value if compressing doesn't make it smaller.
+func compress(c Compressor, value []byte) ([]byte, error) {
+	compressed, err := c.Compress(value)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]byte, 0, len(compressionHeader)+1+len(compressed))
+	result = append(append(append(result, compressionHeader...), c.ID()), compressed...)
+
+	// A plain value that looks like it has a header must be compressed, or it would be misread later.
+	if len(result) >= len(value) && !hasEncodedHeader(value) {
+		return value, nil
+	}
+
+	return result, nil
+}
+
+// decompress reverses compress. The configured Compressor is tried first, then the built in ones.
+func decompress(c Compressor, value []byte) ([]byte, error) {
+	if !bytes.HasPrefix(value, compressionHeader) || len(value) == len(compressionHeader) {
+		return value, nil
+	}
+
+	id := value[len(compressionHeader)]
+	if c == nil || c.ID() != id {
+		var ok bool
+		if c, ok = builtinCompressors[id]; !ok {
+			return nil, fmt.Errorf("value was compressed with unknown compressor id %d", id)
+		}
+	}
+
+	return c.Decompress(value[len(compressionHeader)+1:])
+}
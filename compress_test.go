@@ -0,0 +1,83 @@
+package mapstore
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCompressionRoundTrip(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := NewWithOptions(storeTestName, WithCache(true), WithCompression(Gzip))
+	assert.NoError(t, err)
+
+	big := bytes.Repeat([]byte(`{"hello":"world"},`), 100)
+	assert.NoError(t, kv.Set("big", big))
+	assert.NoError(t, kv.Set("small", []byte("tiny")))
+
+	// Only the value that gets smaller is stored compressed.
+	assert.True(t, bytes.HasPrefix(kv.internalCache["big"], compressionHeader))
+	assert.Less(t, len(kv.internalCache["big"]), len(big))
+	assert.Equal(t, []byte("tiny"), kv.internalCache["small"])
+
+	val, err := kv.Get("big")
+	assert.NoError(t, err)
+	assert.Equal(t, big, val)
+
+	raw, err := kv.Raw()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"big": big, "small": []byte("tiny")}, raw)
+
+	// Setting the same value again is still a no-op.
+	stored := kv.internalCache["big"]
+	kv.client = nil
+	assert.NoError(t, kv.Set("big", big))
+	assert.Equal(t, stored, kv.internalCache["big"])
+}
+
+func TestCompressionMixedManagers(t *testing.T) {
+	setFakeKubeClient(t)
+
+	plain, err := New(storeTestName, false)
+	assert.NoError(t, err)
+	compressed, err := NewWithOptions(storeTestName, WithCompression(NewGzip(9)))
+	assert.NoError(t, err)
+
+	// Existing uncompressed data keeps working.
+	big := bytes.Repeat([]byte("abc"), 100)
+	assert.NoError(t, plain.Set("old", big))
+
+	val, err := compressed.Get("old")
+	assert.NoError(t, err)
+	assert.Equal(t, big, val)
+
+	// And compressed values can be read without compression enabled.
+	assert.NoError(t, compressed.Set("new", big))
+
+	val, err = plain.Get("new")
+	assert.NoError(t, err)
+	assert.Equal(t, big, val)
+
+	swapped, err := plain.CompareAndSwap("new", big, []byte("swapped"))
+	assert.NoError(t, err)
+	assert.True(t, swapped)
+}
+
+func TestCompressionHeaderCollision(t *testing.T) {
+	value := append(append([]byte{}, compressionHeader...), 1)
+
+	result, err := compress(Gzip, value)
+	assert.NoError(t, err)
+	assert.NotEqual(t, value, result)
+
+	decoded, err := decompress(nil, result)
+	assert.NoError(t, err)
+	assert.Equal(t, value, decoded)
+}
+
+func TestCompressionUnknownID(t *testing.T) {
+	_, err := decompress(nil, append(append([]byte{}, compressionHeader...), 200, 1, 2))
+	assert.Error(t, err)
+}
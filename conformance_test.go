@@ -0,0 +1,237 @@
+package mapstore_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/unrolled/mapstore"
+	"github.com/unrolled/mapstore/mapstoretest"
+	"github.com/unrolled/mapstore/memstore"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+const conformanceName = "conformance"
+
+// conformanceOptions points a store at a new fake clientset, so every test starts out empty.
+func conformanceOptions(opts ...mapstore.Option) []mapstore.Option {
+	return append(opts, mapstore.WithClientset(fake.NewSimpleClientset()), mapstore.WithNamespace("conformance"))
+}
+
+// conformanceKeyProvider returns a KeyProvider with a fixed key.
+func conformanceKeyProvider(t *testing.T) mapstore.KeyProvider {
+	provider, err := mapstore.NewStaticKeyProvider("conformance", map[string][]byte{"conformance": bytes.Repeat([]byte{1}, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return provider
+}
+
+func TestConformanceManager(t *testing.T) {
+	provider := conformanceKeyProvider(t)
+
+	for name, opts := range map[string][]mapstore.Option{
+		"Default":     nil,
+		"Cache":       {mapstore.WithCache(true)},
+		"Informer":    {mapstore.WithInformer()},
+		"KeyEncoding": {mapstore.WithKeyEncoding()},
+		"Compression": {mapstore.WithCompression(mapstore.NewGzip(-1))},
+		"Encryption":  {mapstore.WithEncryption(provider)},
+		"Chunking":    {mapstore.WithChunking(64 * 1024)},
+		"Everything": {
+			mapstore.WithCache(true),
+			mapstore.WithKeyEncoding(),
+			mapstore.WithCompression(mapstore.NewGzip(-1)),
+			mapstore.WithEncryption(provider),
+			mapstore.WithChunking(16 * 1024),
+		},
+	} {
+		opts := opts
+		t.Run(name, func(t *testing.T) {
+			mapstoretest.RunConformance(t, func(t *testing.T) mapstore.Interface {
+				kv, err := mapstore.NewWithOptions(conformanceName, conformanceOptions(opts...)...)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				t.Cleanup(kv.Close)
+
+				return kv
+			})
+		})
+	}
+}
+
+func TestConformancePrefixedManager(t *testing.T) {
+	mapstoretest.RunConformance(t, func(t *testing.T) mapstore.Interface {
+		kv, err := mapstore.NewWithOptions(conformanceName, conformanceOptions()...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// A key outside of the view must not show up in it.
+		if err := kv.Set("outside", []byte("value")); err != nil {
+			t.Fatal(err)
+		}
+
+		return kv.WithPrefix("app.")
+	})
+}
+
+func TestConformanceSecretManager(t *testing.T) {
+	mapstoretest.RunConformance(t, func(t *testing.T) mapstore.Interface {
+		kv, err := mapstore.NewSecretWithOptions(conformanceName, conformanceOptions()...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return kv
+	})
+}
+
+func TestConformanceShardedManager(t *testing.T) {
+	mapstoretest.RunConformance(t, func(t *testing.T) mapstore.Interface {
+		kv, err := mapstore.NewSharded(conformanceName, 3, conformanceOptions()...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return kv
+	})
+}
+
+func TestConformanceFileManager(t *testing.T) {
+	for name, file := range map[string]string{"Directory": "store", "Manifest": "store.yaml"} {
+		file := file
+		t.Run(name, func(t *testing.T) {
+			mapstoretest.RunConformance(t, func(t *testing.T) mapstore.Interface {
+				kv, err := mapstore.NewFile(filepath.Join(t.TempDir(), file))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				return kv
+			})
+		})
+	}
+}
+
+func TestConformanceMemstore(t *testing.T) {
+	mapstoretest.RunConformance(t, func(t *testing.T) mapstore.Interface {
+		return memstore.New()
+	})
+}
+
+// volumeStore runs a VolumeManager through the conformance tests. Writes go to a Manager, after which its ConfigMap is
+// projected into a directory the way the kubelet does it, and reads go to a VolumeManager that watches the directory.
+type volumeStore struct {
+	*mapstore.VolumeManager
+	mu      sync.Mutex
+	writer  *mapstore.Manager
+	client  kubernetes.Interface
+	dir     string
+	version int
+}
+
+func (s *volumeStore) Set(key string, value []byte) error {
+	return s.write(func() error { return s.writer.Set(key, value) })
+}
+
+func (s *volumeStore) Delete(key string) error {
+	return s.write(func() error { return s.writer.Delete(key) })
+}
+
+func (s *volumeStore) Truncate() error {
+	return s.write(s.writer.Truncate)
+}
+
+// write applies the write to the Manager, projects the ConfigMap into a new directory that the ..data symlink is then
+// swapped over to, and waits for the VolumeManager to pick it up.
+func (s *volumeStore) write(fn func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := fn(); err != nil {
+		return err
+	}
+
+	cm, err := s.client.CoreV1().ConfigMaps("conformance").Get(context.Background(), conformanceName, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	s.version++
+	versionDir := filepath.Join(s.dir, fmt.Sprintf("..version_%d", s.version))
+	if err := os.Mkdir(versionDir, 0o755); err != nil {
+		return err
+	}
+
+	for key, value := range cm.BinaryData {
+		if err := os.WriteFile(filepath.Join(versionDir, key), value, 0o644); err != nil {
+			return err
+		}
+	}
+
+	dataLink := filepath.Join(s.dir, "..data")
+	old, _ := os.Readlink(dataLink)
+
+	tmpLink := filepath.Join(s.dir, "..data_tmp")
+	if err := os.Symlink(filepath.Base(versionDir), tmpLink); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpLink, dataLink); err != nil {
+		return err
+	}
+
+	if old != "" {
+		if err := os.RemoveAll(filepath.Join(s.dir, old)); err != nil {
+			return err
+		}
+	}
+
+	want, err := s.writer.Raw()
+	if err != nil {
+		return err
+	}
+
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		if got, err := s.VolumeManager.Raw(); err == nil && reflect.DeepEqual(want, got) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("volume did not pick up the update")
+}
+
+func TestConformanceVolumeManager(t *testing.T) {
+	mapstoretest.RunConformance(t, func(t *testing.T) mapstore.Interface {
+		client := fake.NewSimpleClientset()
+		opts := []mapstore.Option{mapstore.WithKeyEncoding(), mapstore.WithCompression(mapstore.NewGzip(-1))}
+
+		writer, err := mapstore.NewWithOptions(conformanceName,
+			append(opts, mapstore.WithClientset(client), mapstore.WithNamespace("conformance"))...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		dir := t.TempDir()
+		volume, err := mapstore.NewVolume(dir, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		t.Cleanup(volume.Close)
+
+		return &volumeStore{VolumeManager: volume, writer: writer, client: client, dir: dir}
+	})
+}
@@ -0,0 +1,270 @@
+package mapstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// encryptionHeader marks the start of an encrypted value and is followed by the envelope: the key ID, the wrapped data
+// key, the nonce and the sealed value. Values without the header are returned as is, so existing data keeps working
+// when encryption is turned on (Rotate encrypts them).
+var encryptionHeader = []byte("\x00mse")
+
+// dataKeySize is the size of the AES-256 keys that values are encrypted with.
+const dataKeySize = 32
+
+// maxCachedDataKeys bounds the number of unwrapped data keys a Manager keeps around.
+const maxCachedDataKeys = 1024
+
+// ErrDecryptionFailed is returned when an encrypted value can not be decrypted, because no KeyProvider is configured,
+// the key is unknown or the value has been tampered with.
+var ErrDecryptionFailed = fmt.Errorf("value could not be decrypted")
+
+// KeyProvider wraps and unwraps the data keys that values are encrypted with. Implementations typically hand the work
+// off to a key management service, so the key encryption keys never leave it.
+type KeyProvider interface {
+	// WrapKey encrypts the data key with the current key encryption key and returns the ID of that key, which is
+	// stored next to every value so it can be unwrapped after the current key has been rotated.
+	WrapKey(ctx context.Context, dataKey []byte) (keyID string, wrappedKey []byte, err error)
+	// UnwrapKey decrypts a data key that was wrapped with the key of the given ID.
+	UnwrapKey(ctx context.Context, keyID string, wrappedKey []byte) ([]byte, error)
+}
+
+type staticKeyProvider struct {
+	currentKeyID string
+	keys         map[string]cipher.AEAD
+}
+
+// NewStaticKeyProvider returns a KeyProvider that wraps data keys locally with AES-256-GCM. The keys map holds every
+// 32 byte key encryption key by ID, and new data keys are wrapped with the key of currentKeyID. Keep old keys in the
+// map until Rotate has re-encrypted everything with the current one.
+func NewStaticKeyProvider(currentKeyID string, keys map[string][]byte) (KeyProvider, error) {
+	p := &staticKeyProvider{currentKeyID, map[string]cipher.AEAD{}}
+	for id, key := range keys {
+		if len(key) != dataKeySize {
+			return nil, fmt.Errorf("key %q must be %d bytes, got %d", id, dataKeySize, len(key))
+		}
+
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, err
+		}
+
+		p.keys[id] = aead
+	}
+
+	if _, ok := p.keys[currentKeyID]; !ok {
+		return nil, fmt.Errorf("current key %q is not one of the keys", currentKeyID)
+	}
+
+	return p, nil
+}
+
+func (p *staticKeyProvider) WrapKey(_ context.Context, dataKey []byte) (string, []byte, error) {
+	wrapped, err := seal(p.keys[p.currentKeyID], dataKey, []byte(p.currentKeyID))
+	return p.currentKeyID, wrapped, err
+}
+
+func (p *staticKeyProvider) UnwrapKey(_ context.Context, keyID string, wrappedKey []byte) ([]byte, error) {
+	aead, ok := p.keys[keyID]
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", keyID)
+	}
+
+	return open(aead, wrappedKey, []byte(keyID))
+}
+
+// dataKeyCache holds unwrapped data keys by key ID and wrapped key, so reads don't have to call the KeyProvider for
+// every value.
+type dataKeyCache struct {
+	*sync.Mutex
+	keys map[string][]byte
+}
+
+func newDataKeyCache() *dataKeyCache {
+	return &dataKeyCache{&sync.Mutex{}, map[string][]byte{}}
+}
+
+func (c *dataKeyCache) get(id string) ([]byte, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	key, ok := c.keys[id]
+	return key, ok
+}
+
+func (c *dataKeyCache) set(id string, key []byte) {
+	c.Lock()
+	defer c.Unlock()
+
+	// Start over rather than tracking which keys are still in use.
+	if len(c.keys) >= maxCachedDataKeys {
+		c.keys = map[string][]byte{}
+	}
+
+	c.keys[id] = key
+}
+
+// envelope is the parsed form of an encrypted value.
+type envelope struct {
+	keyID      string
+	wrappedKey []byte
+	sealed     []byte
+}
+
+// parseEnvelope returns the envelope if the stored value is one.
+func parseEnvelope(value []byte) (*envelope, bool) {
+	if !bytes.HasPrefix(value, encryptionHeader) {
+		return nil, false
+	}
+
+	rest := value[len(encryptionHeader):]
+	if len(rest) < 1 || len(rest) < 1+int(rest[0])+2 {
+		return nil, false
+	}
+
+	e := &envelope{keyID: string(rest[1 : 1+rest[0]])}
+	rest = rest[1+rest[0]:]
+
+	size := int(binary.BigEndian.Uint16(rest))
+	if len(rest) < 2+size {
+		return nil, false
+	}
+
+	e.wrappedKey, e.sealed = rest[2:2+size], rest[2+size:]
+
+	return e, true
+}
+
+func (e *envelope) marshal() []byte {
+	result := make([]byte, 0, len(encryptionHeader)+1+len(e.keyID)+2+len(e.wrappedKey)+len(e.sealed))
+	result = append(append(result, encryptionHeader...), byte(len(e.keyID)))
+	result = append(result, e.keyID...)
+	result = append(result, byte(len(e.wrappedKey)>>8), byte(len(e.wrappedKey)))
+	result = append(result, e.wrappedKey...)
+
+	return append(result, e.sealed...)
+}
+
+// encrypt seals the value with a new data key. The key name is bound to the value, so an encrypted value can not be
+// moved to another key.
+func (k *Manager) encrypt(ctx context.Context, key string, value []byte) ([]byte, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return nil, err
+	}
+
+	keyID, wrappedKey, err := k.keyProvider.WrapKey(ctx, dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("wrapping data key: %w", err)
+	}
+
+	if len(keyID) > 255 || len(wrappedKey) > 65535 {
+		return nil, fmt.Errorf("key ID or wrapped data key is too long")
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	sealed, err := seal(aead, value, []byte(key))
+	if err != nil {
+		return nil, err
+	}
+
+	e := &envelope{keyID: keyID, wrappedKey: wrappedKey, sealed: sealed}
+
+	return e.marshal(), nil
+}
+
+// decrypt reverses encrypt. Values that are not encrypted are returned as is.
+func (k *Manager) decrypt(ctx context.Context, key string, value []byte) ([]byte, error) {
+	e, ok := parseEnvelope(value)
+	if !ok {
+		return value, nil
+	}
+
+	if k.keyProvider == nil {
+		return nil, fmt.Errorf("%w: no KeyProvider is configured", ErrDecryptionFailed)
+	}
+
+	cacheID := e.keyID + "\x00" + string(e.wrappedKey)
+	dataKey, ok := k.dataKeys.get(cacheID)
+	if !ok {
+		var err error
+		if dataKey, err = k.keyProvider.UnwrapKey(ctx, e.keyID, e.wrappedKey); err != nil {
+			return nil, fmt.Errorf("%w: unwrapping data key: %v", ErrDecryptionFailed, err)
+		}
+
+		k.dataKeys.set(cacheID, dataKey)
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecryptionFailed, err)
+	}
+
+	plain, err := open(aead, e.sealed, []byte(key))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrDecryptionFailed, err)
+	}
+
+	return plain, nil
+}
+
+// Rotate re-encrypts every value with a new data key wrapped by the current key of the KeyProvider, including values
+// that were written before encryption was turned on. All the values are written back in a single update, and nothing
+// is written if any value can not be decrypted.
+func (k *Manager) Rotate() error {
+	return k.RotateContext(k.ctx)
+}
+
+// RotateContext is the same as Rotate, but uses the given context for the API calls.
+func (k *Manager) RotateContext(ctx context.Context) error {
+	if k.keyProvider == nil {
+		return fmt.Errorf("encryption is not enabled")
+	}
+
+	k.Lock()
+	defer k.Unlock()
+
+	return k.rewrite(ctx, true, true, nil, func(data map[string][]byte) (bool, error) {
+		return len(data) > 0, nil
+	})
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts the plaintext and returns it prefixed with a random nonce.
+func seal(aead cipher.AEAD, plaintext, additionalData []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additionalData), nil
+}
+
+// open reverses seal.
+func open(aead cipher.AEAD, sealed, additionalData []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("sealed value is too short")
+	}
+
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additionalData)
+}
@@ -0,0 +1,184 @@
+package mapstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testKeyProvider(t *testing.T, current string) KeyProvider {
+	provider, err := NewStaticKeyProvider(current, map[string][]byte{
+		"old": bytes.Repeat([]byte{1}, 32),
+		"new": bytes.Repeat([]byte{2}, 32),
+	})
+	assert.NoError(t, err)
+
+	return provider
+}
+
+func TestEncryptionRoundTrip(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := NewWithOptions(storeTestName, WithCache(true), WithEncryption(testKeyProvider(t, "old")))
+	assert.NoError(t, err)
+
+	assert.NoError(t, kv.Set("token", []byte("s3cr3t")))
+
+	// The stored value is an envelope that doesn't contain the plaintext.
+	stored := kv.internalCache["token"]
+	e, ok := parseEnvelope(stored)
+	assert.True(t, ok)
+	assert.Equal(t, "old", e.keyID)
+	assert.False(t, bytes.Contains(stored, []byte("s3cr3t")))
+
+	val, err := kv.Get("token")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("s3cr3t"), val)
+
+	raw, err := kv.Raw()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"token": []byte("s3cr3t")}, raw)
+
+	// Setting the same value again is still a no-op.
+	kv.client = nil
+	assert.NoError(t, kv.Set("token", []byte("s3cr3t")))
+	assert.Equal(t, stored, kv.internalCache["token"])
+}
+
+func TestEncryptionWithCompression(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := NewWithOptions(storeTestName, WithCache(true), WithCompression(Gzip), WithEncryption(testKeyProvider(t, "old")))
+	assert.NoError(t, err)
+
+	big := bytes.Repeat([]byte(`{"hello":"world"},`), 100)
+	assert.NoError(t, kv.Set("big", big))
+	assert.Less(t, len(kv.internalCache["big"]), len(big))
+
+	val, err := kv.Get("big")
+	assert.NoError(t, err)
+	assert.Equal(t, big, val)
+}
+
+func TestEncryptionErrors(t *testing.T) {
+	setFakeKubeClient(t)
+
+	encrypted, err := NewWithOptions(storeTestName, WithEncryption(testKeyProvider(t, "new")))
+	assert.NoError(t, err)
+	assert.NoError(t, encrypted.Set("token", []byte("s3cr3t")))
+
+	// Without the KeyProvider or the right key, the value can't be read.
+	plain, err := New(storeTestName, false)
+	assert.NoError(t, err)
+
+	_, err = plain.Get("token")
+	assert.True(t, errors.Is(err, ErrDecryptionFailed))
+
+	provider, err := NewStaticKeyProvider("old", map[string][]byte{"old": bytes.Repeat([]byte{1}, 32)})
+	assert.NoError(t, err)
+	other, err := NewWithOptions(storeTestName, WithEncryption(provider))
+	assert.NoError(t, err)
+
+	_, err = other.Get("token")
+	assert.True(t, errors.Is(err, ErrDecryptionFailed))
+
+	// Writes to other keys carry the value over untouched.
+	assert.NoError(t, plain.Set("other", []byte("value")))
+
+	val, err := encrypted.Get("token")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("s3cr3t"), val)
+
+	// A value moved to another key is rejected.
+	stored, err := encrypted.client.get(encrypted.ctx, storeTestName)
+	assert.NoError(t, err)
+	stored["moved"] = stored["token"]
+	assert.NoError(t, encrypted.client.set(encrypted.ctx, storeTestName, stored))
+
+	_, err = encrypted.Get("moved")
+	assert.True(t, errors.Is(err, ErrDecryptionFailed))
+}
+
+func TestEncryptionRotate(t *testing.T) {
+	setFakeKubeClient(t)
+
+	plain, err := New(storeTestName, false)
+	assert.NoError(t, err)
+	assert.NoError(t, plain.Set("legacy", []byte("plain")))
+
+	kv, err := NewWithOptions(storeTestName, WithEncryption(testKeyProvider(t, "old")))
+	assert.NoError(t, err)
+	assert.NoError(t, kv.Set("token", []byte("s3cr3t")))
+
+	// Unencrypted values are still readable.
+	val, err := kv.Get("legacy")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("plain"), val)
+
+	kv.keyProvider = testKeyProvider(t, "new")
+	assert.NoError(t, kv.Rotate())
+
+	stored, err := kv.client.get(kv.ctx, storeTestName)
+	assert.NoError(t, err)
+	for key, value := range stored {
+		e, ok := parseEnvelope(value)
+		assert.True(t, ok, key)
+		assert.Equal(t, "new", e.keyID, key)
+	}
+
+	raw, err := kv.Raw()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"legacy": []byte("plain"), "token": []byte("s3cr3t")}, raw)
+
+	// Nothing is written if a value can't be decrypted.
+	provider, err := NewStaticKeyProvider("other", map[string][]byte{"other": bytes.Repeat([]byte{3}, 32)})
+	assert.NoError(t, err)
+	other, err := NewWithOptions(storeTestName, WithEncryption(provider))
+	assert.NoError(t, err)
+
+	assert.True(t, errors.Is(other.Rotate(), ErrDecryptionFailed))
+
+	after, err := kv.client.get(kv.ctx, storeTestName)
+	assert.NoError(t, err)
+	assert.Equal(t, stored, after)
+
+	// Rotate needs encryption to be enabled.
+	assert.Error(t, plain.RotateContext(context.Background()))
+}
+
+func TestEncryptionStaticKeyProvider(t *testing.T) {
+	_, err := NewStaticKeyProvider("a", map[string][]byte{"a": []byte("short")})
+	assert.Error(t, err)
+
+	_, err = NewStaticKeyProvider("missing", map[string][]byte{"a": bytes.Repeat([]byte{1}, 32)})
+	assert.Error(t, err)
+
+	provider := testKeyProvider(t, "new")
+	id, wrapped, err := provider.WrapKey(context.Background(), []byte("data key"))
+	assert.NoError(t, err)
+	assert.Equal(t, "new", id)
+
+	unwrapped, err := provider.UnwrapKey(context.Background(), id, wrapped)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("data key"), unwrapped)
+
+	_, err = provider.UnwrapKey(context.Background(), "old", wrapped)
+	assert.Error(t, err)
+}
+
+func TestEncryptionEnvelope(t *testing.T) {
+	e := &envelope{keyID: "key", wrappedKey: []byte("wrapped"), sealed: []byte("sealed")}
+
+	parsed, ok := parseEnvelope(e.marshal())
+	assert.True(t, ok)
+	assert.Equal(t, e, parsed)
+
+	// Truncated envelopes are not mistaken for encrypted values.
+	_, ok = parseEnvelope(e.marshal()[:8])
+	assert.False(t, ok)
+	_, ok = parseEnvelope([]byte("plain"))
+	assert.False(t, ok)
+}
@@ -2,7 +2,6 @@
 package main
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
 
@@ -15,31 +14,6 @@ type userObject struct {
 	Email    string `json:"email"`
 }
 
-type userStore struct {
-	kvStore mapstore.Interface
-}
-
-func (u *userStore) Get(key string) (*userObject, error) {
-	val, err := u.kvStore.Get(key)
-	if err != nil {
-		return nil, err
-	}
-
-	var result *userObject
-	err = json.Unmarshal(val, result)
-
-	return result, err
-}
-
-func (u *userStore) Set(key string, val *userObject) error {
-	result, err := json.Marshal(val)
-	if err != nil {
-		return err
-	}
-
-	return u.kvStore.Set(key, result)
-}
-
 func custom() {
 	// Because we are not caching the config map, every request will require going out and looking up the config map.
 	// But you need to be aware of the limitations (see main README.md for documentation)!
@@ -51,7 +25,9 @@ func custom() {
 		log.Fatalf("error creating mapstore (possible rbac issue?): %v", err)
 	}
 
-	wrapper := &userStore{mapStore}
+	// The typed store takes care of the json serialization. Other codecs include mapstore.YAML, mapstore.Gob and
+	// mapstore.Proto.
+	wrapper := mapstore.NewTypedStore(mapStore, mapstore.JSON[*userObject]())
 	initialData := &userObject{ID: 1234, UserName: "FooBar", Email: "mapstore@example.com"}
 
 	// Setting the user data.
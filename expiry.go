@@ -0,0 +1,239 @@
+package mapstore
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// expiryKey is the reserved key that holds the expiry times of the keys that were set with a TTL, as JSON. Storing
+// them next to the values means a value and its expiry are always written together.
+const expiryKey = ".mapstore.expiry"
+
+// timeNow is replaced by tests.
+var timeNow = time.Now
+
+// expiries maps keys to the time they expire at.
+type expiries map[string]time.Time
+
+// parseExpiries reads the decoded value of expiryKey. Unreadable metadata is ignored, and replaced on the next write.
+func parseExpiries(value []byte) expiries {
+	exp := expiries{}
+	if err := json.Unmarshal(value, &exp); err != nil {
+		return expiries{}
+	}
+
+	return exp
+}
+
+func (e expiries) expired(key string, now time.Time) bool {
+	at, ok := e[key]
+	return ok && !at.After(now)
+}
+
+// takeExpiries removes the expiry metadata from the decoded data, along with every key that has expired, and returns
+// the expiry times of the keys that are left.
+func takeExpiries(data map[string][]byte, now time.Time) expiries {
+	value, ok := data[expiryKey]
+	if !ok {
+		return expiries{}
+	}
+
+	delete(data, expiryKey)
+	exp := parseExpiries(value)
+
+	for key := range exp {
+		if _, ok := data[key]; !ok {
+			delete(exp, key)
+		} else if exp.expired(key, now) {
+			delete(data, key)
+			delete(exp, key)
+		}
+	}
+
+	return exp
+}
+
+// putExpiries updates the expiry times after a mutation turned the original data into data, and stores them in the
+// data. Keys that were changed or removed lose their TTL, unless a new expiry time is given for them in expiresAt.
+func putExpiries(exp expiries, original, data map[string][]byte, expiresAt expiries) error {
+	for key := range exp {
+		if value, ok := data[key]; !ok || !bytes.Equal(value, original[key]) {
+			delete(exp, key)
+		}
+	}
+
+	for key, at := range expiresAt {
+		if _, ok := data[key]; ok {
+			exp[key] = at
+		}
+	}
+
+	if len(exp) == 0 {
+		return nil
+	}
+
+	value, err := json.Marshal(exp)
+	if err != nil {
+		return err
+	}
+
+	data[expiryKey] = value
+
+	return nil
+}
+
+// liveData returns the stored data without the expiry metadata and the keys that have expired. The stored data is
+// returned as is if no key has a TTL.
+func (k *Manager) liveData(ctx context.Context, stored map[string][]byte) map[string][]byte {
+	value, ok := stored[expiryKey]
+	if !ok {
+		return stored
+	}
+
+	exp := expiries{}
+	if decoded, err := k.decodeValue(ctx, expiryKey, value); err == nil {
+		exp = parseExpiries(decoded)
+	}
+
+	now := timeNow()
+	live := make(map[string][]byte, len(stored))
+	for key, val := range stored {
+		if key != expiryKey && !exp.expired(key, now) {
+			live[key] = val
+		}
+	}
+
+	return live
+}
+
+// storedExpiries returns the expiry times of the keys that were set with a TTL, by their stored key. Like liveData,
+// unreadable metadata is ignored.
+func (k *Manager) storedExpiries(ctx context.Context) (expiries, error) {
+	k.Lock()
+	defer k.Unlock()
+
+	_, stored, err := k.load(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	value, ok := stored[expiryKey]
+	if !ok {
+		return expiries{}, nil
+	}
+
+	decoded, err := k.decodeValue(ctx, expiryKey, value)
+	if err != nil {
+		return expiries{}, nil
+	}
+
+	return parseExpiries(decoded), nil
+}
+
+// setManyWithExpiries sets the values like SetMany, and makes the keys in expiresAt (by their stored key) expire at the
+// given times. The other keys lose their TTL.
+func (k *Manager) setManyWithExpiries(ctx context.Context, values map[string][]byte, expiresAt expiries) error {
+	stored := make(map[string][]byte, len(values))
+	for key, value := range values {
+		storedKey, err := k.checkKey(key)
+		if err != nil {
+			return err
+		}
+
+		stored[storedKey] = value
+	}
+
+	k.Lock()
+	defer k.Unlock()
+
+	return k.rewrite(ctx, false, false, expiresAt, func(data map[string][]byte) (bool, error) {
+		// Always write when there are expiry times, as they may be the only thing that changed.
+		changed := len(expiresAt) > 0
+		for key, value := range stored {
+			if ogValue, ok := data[key]; ok && bytes.Equal(ogValue, value) {
+				continue
+			}
+
+			data[key] = value
+			changed = true
+		}
+
+		return changed, nil
+	})
+}
+
+// SetWithTTL sets the value of the key like ForceSet, and makes it expire after the given duration. Expired keys are
+// treated as if they don't exist, and are removed by the next write to the ConfigMap (or by the janitor). Setting a
+// new value with any of the other methods removes the TTL.
+func (k *Manager) SetWithTTL(key string, value []byte, ttl time.Duration) error {
+	return k.SetWithTTLContext(k.ctx, key, value, ttl)
+}
+
+// SetWithTTLContext is the same as SetWithTTL, but uses the given context for the API calls.
+func (k *Manager) SetWithTTLContext(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("ttl must be positive, got %s", ttl)
+	}
+
+	key, err := k.checkKey(key)
+	if err != nil {
+		return err
+	}
+
+	k.Lock()
+	defer k.Unlock()
+
+	expiresAt := expiries{key: timeNow().Add(ttl)}
+
+	return k.rewrite(ctx, false, false, expiresAt, func(data map[string][]byte) (bool, error) {
+		data[key] = value
+
+		return true, nil
+	})
+}
+
+// DeleteExpired removes every key that has expired from the ConfigMap with a single write. Nothing is written if no
+// key has expired.
+func (k *Manager) DeleteExpired() error {
+	return k.DeleteExpiredContext(k.ctx)
+}
+
+// DeleteExpiredContext is the same as DeleteExpired, but uses the given context for the API calls.
+func (k *Manager) DeleteExpiredContext(ctx context.Context) error {
+	k.Lock()
+	defer k.Unlock()
+
+	_, stored, err := k.load(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	// Any write removes the expired keys, so only write if there are any.
+	if _, ok := stored[expiryKey]; !ok || len(k.liveData(ctx, stored)) == len(stored)-1 {
+		return nil
+	}
+
+	return k.mutate(ctx, false, func(data map[string][]byte) (bool, error) {
+		return true, nil
+	})
+}
+
+// startJanitor calls DeleteExpired every interval until Close is called.
+func (k *Manager) startJanitor(interval time.Duration) {
+	go func(stopCh <-chan struct{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-stopCh:
+				return
+			case <-ticker.C:
+				_ = k.DeleteExpired()
+			}
+		}
+	}(k.stopCh)
+}
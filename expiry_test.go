@@ -0,0 +1,154 @@
+package mapstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// setFakeTime makes timeNow return the returned time, which can be moved forward by the test.
+func setFakeTime(t *testing.T) *time.Time {
+	now := time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)
+	timeNow = func() time.Time { return now }
+	t.Cleanup(func() { timeNow = time.Now })
+
+	return &now
+}
+
+func TestExpirySetWithTTL(t *testing.T) {
+	setFakeKubeClient(t)
+	now := setFakeTime(t)
+
+	kv, err := New(storeTestName, false)
+	assert.NoError(t, err)
+
+	assert.NoError(t, kv.Set("plain", []byte("stays")))
+	assert.NoError(t, kv.SetWithTTL("lease", []byte("holder"), time.Minute))
+
+	val, err := kv.Get("lease")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("holder"), val)
+
+	// The metadata is not visible as a key.
+	keys, err := kv.Keys()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"plain", "lease"}, keys)
+
+	*now = now.Add(time.Minute)
+
+	_, err = kv.Get("lease")
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	keys, err = kv.Keys()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"plain"}, keys)
+
+	raw, err := kv.Raw()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"plain": []byte("stays")}, raw)
+
+	many, err := kv.GetMany([]string{"plain", "lease"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"plain": []byte("stays")}, many)
+
+	// Expired keys are absent for conditional writes too.
+	set, err := kv.SetIfAbsent("lease", []byte("next"))
+	assert.NoError(t, err)
+	assert.True(t, set)
+
+	val, err = kv.Get("lease")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("next"), val)
+
+	assert.Error(t, kv.SetWithTTL("lease", []byte("next"), 0))
+}
+
+func TestExpiryClearedBySet(t *testing.T) {
+	setFakeKubeClient(t)
+	now := setFakeTime(t)
+
+	kv, err := New(storeTestName, false)
+	assert.NoError(t, err)
+
+	assert.NoError(t, kv.SetWithTTL("one", []byte("1"), time.Minute))
+	assert.NoError(t, kv.SetWithTTL("two", []byte("2"), time.Minute))
+	assert.NoError(t, kv.Set("one", []byte("changed")))
+
+	// Setting the same value keeps the TTL.
+	assert.NoError(t, kv.Set("two", []byte("2")))
+
+	*now = now.Add(time.Hour)
+
+	keys, err := kv.Keys()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"one"}, keys)
+
+	// The next write drops the expired key and the metadata that is no longer needed.
+	assert.NoError(t, kv.Set("three", []byte("3")))
+
+	stored, err := kv.client.get(kv.ctx, storeTestName)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"one": []byte("changed"), "three": []byte("3")}, stored)
+}
+
+func TestExpiryDeleteExpired(t *testing.T) {
+	client := setFakeKubeClient(t)
+	now := setFakeTime(t)
+
+	kv, err := New(storeTestName, true)
+	assert.NoError(t, err)
+
+	assert.NoError(t, kv.SetMany(map[string][]byte{"a": []byte("1"), "b": []byte("2")}))
+	assert.NoError(t, kv.SetWithTTL("a", []byte("1"), time.Minute))
+	assert.NoError(t, kv.SetWithTTL("b", []byte("2"), time.Hour))
+
+	// Nothing has expired, so the ConfigMap is only read.
+	actions := len(client.Actions())
+	assert.NoError(t, kv.DeleteExpired())
+	assert.Len(t, client.Actions(), actions+1)
+
+	*now = now.Add(2 * time.Minute)
+	assert.NoError(t, kv.DeleteExpired())
+
+	stored, err := kv.client.get(kv.ctx, storeTestName)
+	assert.NoError(t, err)
+	assert.Contains(t, stored, "b")
+	assert.Contains(t, stored, expiryKey)
+	assert.NotContains(t, stored, "a")
+}
+
+func TestExpiryWithEncryption(t *testing.T) {
+	setFakeKubeClient(t)
+	now := setFakeTime(t)
+
+	kv, err := NewWithOptions(storeTestName, WithEncryption(testKeyProvider(t, "new")))
+	assert.NoError(t, err)
+
+	assert.NoError(t, kv.SetWithTTL("token", []byte("s3cr3t"), time.Minute))
+
+	stored, err := kv.client.get(kv.ctx, storeTestName)
+	assert.NoError(t, err)
+	_, ok := parseEnvelope(stored[expiryKey])
+	assert.True(t, ok)
+
+	*now = now.Add(time.Minute)
+
+	_, err = kv.Get("token")
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestExpiryJanitor(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := NewWithOptions(storeTestName, WithJanitor(10*time.Millisecond))
+	assert.NoError(t, err)
+	defer kv.Close()
+
+	assert.NoError(t, kv.SetWithTTL("short", []byte("lived"), 20*time.Millisecond))
+
+	assert.Eventually(t, func() bool {
+		stored, err := kv.client.get(kv.ctx, storeTestName)
+		return err == nil && len(stored) == 0
+	}, 2*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,79 @@
+package mapstore
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"k8s.io/client-go/kubernetes"
+)
+
+// ManagerFactory hands out Managers for ConfigMaps in any namespace, all sharing a single connection to the cluster.
+type ManagerFactory struct {
+	*sync.Mutex
+	clientset kubernetes.Interface
+	ctx       context.Context
+	opts      []Option
+	clients   map[string]*kubeClient
+}
+
+// NewManagerFactory connects to the cluster described by the options (or the environment, like New). The options are
+// also applied to every Manager the factory creates, except for WithNamespace.
+func NewManagerFactory(opts ...Option) (*ManagerFactory, error) {
+	o := newOptions(opts)
+
+	var err error
+	var clientset kubernetes.Interface
+
+	if o.hasConnection() {
+		clientset, err = o.newClientset()
+	} else {
+		var shared *kubeClient
+		if shared, err = getKubeClient(); err == nil {
+			clientset = shared.client
+		}
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &ManagerFactory{
+		Mutex:     &sync.Mutex{},
+		clientset: clientset,
+		ctx:       o.context(),
+		opts:      opts,
+		clients:   map[string]*kubeClient{},
+	}, nil
+}
+
+// Manager returns a new Manager for the named ConfigMap in the given namespace. Any options are applied on top of the
+// options given to the factory. Every Manager shares the connection of the factory, so the connection options and
+// WithNamespace are rejected here.
+func (f *ManagerFactory) Manager(namespace, cmName string, opts ...Option) (*Manager, error) {
+	if namespace == "" {
+		return nil, fmt.Errorf("namespace must not be empty")
+	}
+
+	if o := newOptions(opts); o.hasConnection() || o.namespace != "" {
+		return nil, fmt.Errorf("connection options and WithNamespace can only be given to NewManagerFactory")
+	}
+
+	o := newOptions(append(append([]Option{}, f.opts...), opts...))
+
+	return newManager(cmName, f.kubeClient(namespace), o)
+}
+
+// kubeClient returns the cached client for the namespace, creating it on first use.
+func (f *ManagerFactory) kubeClient(namespace string) *kubeClient {
+	f.Lock()
+	defer f.Unlock()
+
+	client, ok := f.clients[namespace]
+	if !ok {
+		client = &kubeClient{f.clientset, f.ctx, namespace}
+		f.clients[namespace] = client
+	}
+
+	return client
+}
@@ -0,0 +1,74 @@
+package mapstore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/rest"
+)
+
+func TestFactoryManagers(t *testing.T) {
+	client := newFakeClientset()
+
+	factory, err := NewManagerFactory(WithClientset(client))
+	assert.NoError(t, err)
+
+	kv1, err := factory.Manager("tenant-a", storeTestName)
+	assert.NoError(t, err)
+	kv2, err := factory.Manager("tenant-b", storeTestName, WithCache(true))
+	assert.NoError(t, err)
+	assert.False(t, kv1.cacheEnabled)
+	assert.True(t, kv2.cacheEnabled)
+
+	// Same ConfigMap name, but different namespaces.
+	assert.NoError(t, kv1.Set("hello", []byte("a")))
+	assert.NoError(t, kv2.Set("hello", []byte("b")))
+
+	val, err := kv1.Get("hello")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("a"), val)
+
+	val, err = kv2.Get("hello")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("b"), val)
+
+	// Clients are shared per namespace.
+	kv3, err := factory.Manager("tenant-a", "another-name")
+	assert.NoError(t, err)
+	assert.Same(t, kv1.client, kv3.client)
+	assert.NotSame(t, kv1.client, kv2.client)
+	assert.Len(t, factory.clients, 2)
+}
+
+func TestFactorySharedClient(t *testing.T) {
+	fake := setFakeKubeClient(t)
+
+	factory, err := NewManagerFactory()
+	assert.NoError(t, err)
+	assert.Equal(t, fake, factory.clientset)
+
+	kv, err := factory.Manager("tenant-a", storeTestName)
+	assert.NoError(t, err)
+	assert.Equal(t, "tenant-a", kv.client.namespace)
+}
+
+func TestFactoryInvalidManager(t *testing.T) {
+	factory, err := NewManagerFactory(WithClientset(newFakeClientset()))
+	assert.NoError(t, err)
+
+	_, err = factory.Manager("", storeTestName)
+	assert.Error(t, err)
+
+	// The connection is shared by every Manager, so it can't be changed per Manager.
+	for _, opt := range []Option{
+		WithClientset(newFakeClientset()),
+		WithRESTConfig(&rest.Config{}),
+		WithKubeconfigPath("kubeconfig"),
+		WithNamespace("tenant-b"),
+	} {
+		_, err = factory.Manager("tenant-a", storeTestName, opt)
+		assert.Error(t, err)
+	}
+
+	assert.Empty(t, factory.clients)
+}
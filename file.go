@@ -0,0 +1,544 @@
+package mapstore
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"sigs.k8s.io/yaml"
+)
+
+const backendEnv = "MAPSTORE_BACKEND"
+
+const (
+	// fileLockName is the lock file in a directory layout. Like the temporary files, it starts with ".." so it can
+	// never collide with a key, the same way the kubelet keeps its own files in a mounted ConfigMap volume.
+	fileLockName   = "..mapstore.lock"
+	fileTempPrefix = "..mapstore.tmp-"
+)
+
+// Verify we meet the requirements for our own interfaces.
+var _ Interface = &FileManager{}
+var _ AdvancedInterface = &FileManager{}
+
+// FileManager is a thread safe key value store that keeps its data on the local file system instead of in a
+// ConfigMap, for running without a cluster. The data is stored in one of two layouts:
+//
+// A directory with one file per key, the same as a ConfigMap mounted as a volume.
+//
+// A single ConfigMap manifest, if the path ends in ".yaml" or ".yml". Values that are valid UTF-8 are kept under
+// data and others under binaryData, so the file can be edited by hand or applied with kubectl.
+//
+// Files are replaced atomically by writing a temporary file and renaming it, and every operation holds an advisory
+// lock on a lock file, so several processes can share the same data.
+type FileManager struct {
+	*sync.RWMutex
+	path     string
+	manifest bool
+}
+
+// NewFile returns a FileManager that stores its data at the given path, creating the directories it needs.
+func NewFile(path string) (*FileManager, error) {
+	path = filepath.Clean(path)
+	ext := filepath.Ext(path)
+	f := &FileManager{RWMutex: &sync.RWMutex{}, path: path, manifest: ext == ".yaml" || ext == ".yml"}
+
+	dir := path
+	if f.manifest {
+		dir = filepath.Dir(path)
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+// Open returns the store for the given name, using the backend selected by the MAPSTORE_BACKEND environment variable:
+//
+// If it is not set, or set to "kubernetes", the store is a Manager for the ConfigMap with the given name.
+//
+// If it is set to a URL like "file:///var/lib/mapstore", the store is a FileManager for the directory with the given
+// name inside the path. Add "?format=yaml" to store the data in a "<name>.yaml" manifest instead.
+func Open(name string) (Interface, error) {
+	backend := os.Getenv(backendEnv)
+	if backend == "" || backend == "kubernetes" {
+		return New(name, false)
+	}
+
+	u, err := url.Parse(backend)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", backendEnv, err)
+	}
+
+	path, ok := fileURLPath(u)
+	if !ok {
+		return nil, fmt.Errorf("unsupported %s %q", backendEnv, backend)
+	}
+
+	if errs := validation.IsDNS1123Subdomain(name); len(errs) > 0 {
+		return nil, fmt.Errorf("invalid name %q: %s", name, strings.Join(errs, ", "))
+	}
+
+	path = filepath.Join(path, name)
+	if u.Query().Get("format") == "yaml" {
+		path += ".yaml"
+	}
+
+	return NewFile(path)
+}
+
+// fileURLPath returns the local path of a file URL, or false if it is not one. Relative paths can be given as
+// "file:data". Windows paths can be given as "file:///C:/data", or as "file://C:/data", which puts the drive letter in
+// the host.
+func fileURLPath(u *url.URL) (string, bool) {
+	if u.Scheme != "file" {
+		return "", false
+	}
+
+	path := u.Path
+	switch {
+	case u.Opaque != "":
+		path = u.Opaque
+	case isDriveLetter(u.Host):
+		path = u.Host + path
+	case u.Host != "" && u.Host != "localhost":
+		return "", false
+	case len(path) >= 3 && path[0] == '/' && isDriveLetter(path[1:3]):
+		path = path[1:]
+	}
+
+	return filepath.FromSlash(path), true
+}
+
+// isDriveLetter reports if s is a Windows drive like "C:".
+func isDriveLetter(s string) bool {
+	return len(s) == 2 && s[1] == ':' && ('a' <= s[0] && s[0] <= 'z' || 'A' <= s[0] && s[0] <= 'Z')
+}
+
+// Keys returns all the key names.
+func (f *FileManager) Keys() ([]string, error) {
+	data, err := f.Raw()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// Get returns the value of the key, or ErrKeyNotFound.
+func (f *FileManager) Get(key string) ([]byte, error) {
+	data, err := f.Raw()
+	if err != nil {
+		return nil, err
+	}
+
+	val, ok := data[key]
+	if !ok {
+		return nil, ErrKeyNotFound
+	}
+
+	return val, nil
+}
+
+// GetMany looks up all the given keys. Keys that do not exist are left out of the result.
+func (f *FileManager) GetMany(keys []string) (map[string][]byte, error) {
+	data, err := f.Raw()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		if val, ok := data[key]; ok {
+			result[key] = val
+		}
+	}
+
+	return result, nil
+}
+
+// Raw returns all the data.
+func (f *FileManager) Raw() (map[string][]byte, error) {
+	var data map[string][]byte
+	err := f.withLock(false, func() error {
+		var err error
+		data, err = f.read()
+
+		return err
+	})
+
+	return data, err
+}
+
+// Set checks if the value has changed before writing it.
+func (f *FileManager) Set(key string, value []byte) error {
+	return f.SetMany(map[string][]byte{key: value})
+}
+
+// ForceSet is the same as Set, but always writes the value.
+func (f *FileManager) ForceSet(key string, value []byte) error {
+	if err := ValidateKey(key); err != nil {
+		return err
+	}
+
+	return f.mutate(func(data map[string][]byte) (bool, error) {
+		data[key] = value
+
+		return true, nil
+	})
+}
+
+// SetMany sets all the given values at once. Like Set, nothing is written if every value is unchanged.
+func (f *FileManager) SetMany(values map[string][]byte) error {
+	for key := range values {
+		if err := ValidateKey(key); err != nil {
+			return err
+		}
+	}
+
+	return f.mutate(func(data map[string][]byte) (bool, error) {
+		changed := false
+		for key, value := range values {
+			if ogValue, ok := data[key]; ok && bytes.Equal(ogValue, value) {
+				continue
+			}
+
+			data[key] = value
+			changed = true
+		}
+
+		return changed, nil
+	})
+}
+
+// CompareAndSwap sets the key to new only if it currently holds old, and reports whether the value was swapped.
+func (f *FileManager) CompareAndSwap(key string, old, new []byte) (bool, error) {
+	if err := ValidateKey(key); err != nil {
+		return false, err
+	}
+
+	swapped := false
+	err := f.mutate(func(data map[string][]byte) (bool, error) {
+		ogValue, ok := data[key]
+		swapped = ok && bytes.Equal(ogValue, old)
+
+		// Nothing to write if the comparison failed or the value stays the same.
+		if !swapped || bytes.Equal(old, new) {
+			return false, nil
+		}
+
+		data[key] = new
+
+		return true, nil
+	})
+
+	return swapped && err == nil, err
+}
+
+// SetIfAbsent sets the key only if it does not exist yet, and reports whether the value was set.
+func (f *FileManager) SetIfAbsent(key string, value []byte) (bool, error) {
+	if err := ValidateKey(key); err != nil {
+		return false, err
+	}
+
+	set := false
+	err := f.mutate(func(data map[string][]byte) (bool, error) {
+		_, exists := data[key]
+		if !exists {
+			data[key] = value
+		}
+
+		set = !exists
+
+		return set, nil
+	})
+
+	return set && err == nil, err
+}
+
+// Update calls fn with the current value of the key and writes back the value it returns, while holding the lock.
+// Returning an error from fn aborts the update and the error is passed through.
+func (f *FileManager) Update(key string, fn func(old []byte, exists bool) ([]byte, error)) error {
+	if err := ValidateKey(key); err != nil {
+		return err
+	}
+
+	return f.mutate(func(data map[string][]byte) (bool, error) {
+		ogValue, exists := data[key]
+
+		value, err := fn(ogValue, exists)
+		if err != nil {
+			return false, err
+		}
+
+		if exists && bytes.Equal(ogValue, value) {
+			return false, nil
+		}
+
+		data[key] = value
+
+		return true, nil
+	})
+}
+
+// Delete removes the key. Deleting a key that does not exist is not an error.
+func (f *FileManager) Delete(key string) error {
+	return f.DeleteMany([]string{key})
+}
+
+// DeleteMany removes all the given keys at once.
+func (f *FileManager) DeleteMany(keys []string) error {
+	return f.mutate(func(data map[string][]byte) (bool, error) {
+		changed := false
+		for _, key := range keys {
+			if _, ok := data[key]; ok {
+				delete(data, key)
+				changed = true
+			}
+		}
+
+		return changed, nil
+	})
+}
+
+// Truncate removes all the data.
+func (f *FileManager) Truncate() error {
+	return f.mutate(func(data map[string][]byte) (bool, error) {
+		for key := range data {
+			delete(data, key)
+		}
+
+		return true, nil
+	})
+}
+
+// mutate applies fn to the current data while holding the exclusive lock, and writes the result if fn changed it and
+// it still fits in a ConfigMap.
+func (f *FileManager) mutate(fn mutateFunc) error {
+	return f.withLock(true, func() error {
+		stored, err := f.read()
+		if err != nil {
+			return err
+		}
+
+		data := make(map[string][]byte, len(stored))
+		for key, val := range stored {
+			data[key] = val
+		}
+
+		if changed, err := fn(data); err != nil || !changed {
+			return err
+		}
+
+		if projected := dataSize(data); projected > MaxSize {
+			return &SizeLimitError{Current: dataSize(stored), Projected: projected}
+		}
+
+		return f.write(stored, data)
+	})
+}
+
+// withLock runs fn while holding both the in process lock and the lock file, shared or exclusive.
+func (f *FileManager) withLock(exclusive bool, fn func() error) error {
+	if exclusive {
+		f.Lock()
+		defer f.Unlock()
+	} else {
+		f.RLock()
+		defer f.RUnlock()
+	}
+
+	lockPath := filepath.Join(f.path, fileLockName)
+	if f.manifest {
+		lockPath = f.path + ".lock"
+	}
+
+	// The lock is released when the file is closed.
+	file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := lockFile(file, exclusive); err != nil {
+		return fmt.Errorf("locking %s: %w", lockPath, err)
+	}
+
+	return fn()
+}
+
+// read returns the stored data. A missing directory or manifest has no data.
+func (f *FileManager) read() (map[string][]byte, error) {
+	if f.manifest {
+		return f.readManifest()
+	}
+
+	return readKeyFiles(f.path)
+}
+
+// readKeyFiles returns the contents of every file in the directory that is named like a key. A missing directory has
+// no data.
+func readKeyFiles(dir string) (map[string][]byte, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return map[string][]byte{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	data := make(map[string][]byte, len(entries))
+	for _, entry := range entries {
+		key := entry.Name()
+		if strings.HasPrefix(key, "..") || ValidateKey(key) != nil {
+			continue
+		}
+
+		// Keys in a mounted volume are symlinks, so look at what they point to.
+		path := filepath.Join(dir, key)
+		if info, err := os.Stat(path); err != nil || info.IsDir() {
+			continue
+		}
+
+		if data[key], err = os.ReadFile(path); err != nil {
+			return nil, err
+		}
+	}
+
+	return data, nil
+}
+
+func (f *FileManager) readManifest() (map[string][]byte, error) {
+	raw, err := os.ReadFile(f.path)
+	if os.IsNotExist(err) {
+		return map[string][]byte{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var cm corev1.ConfigMap
+	if err := yaml.Unmarshal(raw, &cm); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", f.path, err)
+	}
+
+	data := make(map[string][]byte, len(cm.Data)+len(cm.BinaryData))
+	for key, val := range cm.Data {
+		data[key] = []byte(val)
+	}
+
+	for key, val := range cm.BinaryData {
+		data[key] = val
+	}
+
+	return data, nil
+}
+
+// write stores the data, which was read as stored. In the directory layout only the files of changed keys are touched.
+func (f *FileManager) write(stored, data map[string][]byte) error {
+	if f.manifest {
+		return f.writeManifest(data)
+	}
+
+	for key, value := range data {
+		if ogValue, ok := stored[key]; ok && bytes.Equal(ogValue, value) {
+			continue
+		}
+
+		if err := writeFileAtomic(filepath.Join(f.path, key), value); err != nil {
+			return err
+		}
+	}
+
+	for key := range stored {
+		if _, ok := data[key]; ok {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(f.path, key)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (f *FileManager) writeManifest(data map[string][]byte) error {
+	cm := corev1.ConfigMap{
+		TypeMeta:   v1.TypeMeta{APIVersion: "v1", Kind: "ConfigMap"},
+		ObjectMeta: v1.ObjectMeta{Name: strings.TrimSuffix(filepath.Base(f.path), filepath.Ext(f.path))},
+	}
+
+	for key, value := range data {
+		if utf8.Valid(value) {
+			if cm.Data == nil {
+				cm.Data = map[string]string{}
+			}
+
+			cm.Data[key] = string(value)
+		} else {
+			if cm.BinaryData == nil {
+				cm.BinaryData = map[string][]byte{}
+			}
+
+			cm.BinaryData[key] = value
+		}
+	}
+
+	obj, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&cm)
+	if err != nil {
+		return err
+	}
+
+	// The zero creation time would be written as null, which kubectl apply rejects.
+	unstructured.RemoveNestedField(obj, "metadata", "creationTimestamp")
+
+	raw, err := yaml.Marshal(obj)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(f.path, raw)
+}
+
+// writeFileAtomic replaces the file with the given contents, so readers see either the old or the new contents.
+func writeFileAtomic(path string, contents []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), fileTempPrefix)
+	if err != nil {
+		return err
+	}
+
+	// Clean up if anything fails before the rename. After it, this is a no-op.
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(contents); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
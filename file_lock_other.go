@@ -0,0 +1,10 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd || windows)
+
+package mapstore
+
+import "os"
+
+// lockFile is a no-op on platforms without file locking, where only the lock within the process applies.
+func lockFile(file *os.File, exclusive bool) error {
+	return nil
+}
@@ -0,0 +1,192 @@
+package mapstore
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileManagerDirectory(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "store")
+
+	f, err := NewFile(dir)
+	assert.NoError(t, err)
+	assert.False(t, f.manifest)
+
+	assert.NoError(t, f.Set("hello", []byte("world")))
+	assert.NoError(t, f.Set("foo", []byte("bar")))
+
+	// Every key is a file, like in a mounted ConfigMap.
+	raw, err := os.ReadFile(filepath.Join(dir, "hello"))
+	assert.NoError(t, err)
+	assert.Equal(t, "world", string(raw))
+
+	assert.NoError(t, f.Delete("foo"))
+	_, err = os.Stat(filepath.Join(dir, "foo"))
+	assert.True(t, os.IsNotExist(err))
+
+	// Files that are not keys, such as the lock file or the kubelet's own files, are ignored.
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "..data"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "..data", "nested"), []byte("x"), 0o644))
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "subdir"), 0o755))
+
+	keys, err := f.Keys()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"hello"}, keys)
+
+	// Data written by another FileManager, or by hand, is picked up.
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "manual"), []byte("value"), 0o644))
+
+	val, err := f.Get("manual")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("value"), val)
+
+	assert.NoError(t, f.Truncate())
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	for _, entry := range entries {
+		assert.Contains(t, []string{fileLockName, "..data", "subdir"}, entry.Name())
+	}
+}
+
+func TestFileManagerManifest(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "my-config.yaml")
+
+	f, err := NewFile(path)
+	assert.NoError(t, err)
+	assert.True(t, f.manifest)
+
+	assert.NoError(t, f.Set("hello", []byte("world")))
+	assert.NoError(t, f.Set("binary", []byte{0xff, 0x00}))
+
+	raw, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, `apiVersion: v1
+binaryData:
+  binary: /wA=
+data:
+  hello: world
+kind: ConfigMap
+metadata:
+  name: my-config
+`, string(raw))
+
+	// A hand written manifest can be read.
+	assert.NoError(t, os.WriteFile(path, []byte("apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: my-config\ndata:\n  greeting: hi\n"), 0o644))
+
+	val, err := f.Get("greeting")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hi"), val)
+
+	assert.NoError(t, os.WriteFile(path, []byte("data: [not, a, map]"), 0o644))
+	_, err = f.Get("greeting")
+	assert.Error(t, err)
+}
+
+func TestFileManagerErrors(t *testing.T) {
+	f, err := NewFile(t.TempDir())
+	assert.NoError(t, err)
+
+	_, err = f.Get("missing")
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	assert.True(t, errors.Is(f.Set("../escape", []byte("x")), ErrInvalidKey))
+	assert.True(t, errors.Is(f.Set(fileLockName, []byte("x")), ErrInvalidKey))
+
+	err = f.Set("big", make([]byte, MaxSize))
+	assert.True(t, errors.Is(err, ErrSizeLimitExceeded))
+
+	boom := errors.New("boom")
+	assert.Equal(t, boom, f.Update("key", func([]byte, bool) ([]byte, error) { return nil, boom }))
+}
+
+func TestFileManagerSharedAcrossManagers(t *testing.T) {
+	dir := t.TempDir()
+
+	// Separate FileManagers only share the lock file, like separate processes.
+	var wg sync.WaitGroup
+	wins := make(chan int, 8)
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			f, err := NewFile(dir)
+			assert.NoError(t, err)
+
+			set, err := f.SetIfAbsent("claim", []byte(fmt.Sprint(i)))
+			assert.NoError(t, err)
+			if set {
+				wins <- i
+			}
+
+			assert.NoError(t, f.Update("counter", func(old []byte, exists bool) ([]byte, error) {
+				return append(old, 'x'), nil
+			}))
+		}(i)
+	}
+
+	wg.Wait()
+	close(wins)
+	assert.Len(t, wins, 1)
+
+	f, err := NewFile(dir)
+	assert.NoError(t, err)
+
+	val, err := f.Get("counter")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("xxxxxxxx"), val)
+}
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+
+	t.Setenv(backendEnv, "file://"+filepath.ToSlash(dir))
+	store, err := Open("my-config")
+	assert.NoError(t, err)
+	assert.NoError(t, store.Set("hello", []byte("world")))
+	assert.FileExists(t, filepath.Join(dir, "my-config", "hello"))
+
+	t.Setenv(backendEnv, "file://"+filepath.ToSlash(dir)+"?format=yaml")
+	store, err = Open("my-config")
+	assert.NoError(t, err)
+	assert.NoError(t, store.Set("hello", []byte("world")))
+	assert.FileExists(t, filepath.Join(dir, "my-config.yaml"))
+
+	_, err = Open("../escape")
+	assert.Error(t, err)
+
+	// Windows paths, with or without the drive letter in the host.
+	for backend, want := range map[string]string{
+		"file:///C:/data":        "C:/data",
+		"file://C:/data":         "C:/data",
+		"file://localhost/data":  "/data",
+		"file:data":              "data",
+		"file://example.com/tmp": "",
+	} {
+		u, err := url.Parse(backend)
+		assert.NoError(t, err)
+
+		path, ok := fileURLPath(u)
+		assert.Equal(t, want != "", ok, backend)
+		assert.Equal(t, filepath.FromSlash(want), path, backend)
+	}
+
+	t.Setenv(backendEnv, "s3://bucket")
+	_, err = Open("my-config")
+	assert.Error(t, err)
+
+	// The default is the ConfigMap.
+	setFakeKubeClient(t)
+	t.Setenv(backendEnv, "")
+	store, err = Open("my-config")
+	assert.NoError(t, err)
+	assert.IsType(t, &Manager{}, store)
+}
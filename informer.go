@@ -0,0 +1,68 @@
+package mapstore
+
+import "k8s.io/client-go/tools/cache"
+
+// NewWithInformer returns a newly setup Manager with an internal cache that is kept in sync with the ConfigMap by a
+// shared informer. Reads are served from memory, while changes made by other processes (or `kubectl edit`) show up
+// shortly after they happen. Call Close to stop the informer when the Manager is no longer needed.
+func NewWithInformer(cmName string) (*Manager, error) {
+	return NewWithOptions(cmName, WithInformer())
+}
+
+// startInformer keeps the internal cache in sync with the object until Close is called.
+func (k *Manager) startInformer() error {
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    k.onObjectChanged,
+		UpdateFunc: func(_, obj interface{}) { k.onObjectChanged(obj) },
+		DeleteFunc: k.onObjectDeleted,
+	}
+
+	if err := k.store.inform(k.configMapName, handler, k.stopCh); err != nil {
+		k.Close()
+		return err
+	}
+
+	return nil
+}
+
+// Close stops the informer started by NewWithInformer and the janitor started by WithJanitor. It is safe to call on
+// any Manager.
+func (k *Manager) Close() {
+	k.Lock()
+	defer k.Unlock()
+
+	if k.stopCh != nil {
+		close(k.stopCh)
+		k.stopCh = nil
+	}
+}
+
+func (k *Manager) onObjectChanged(obj interface{}) {
+	changed, ok := k.store.convert(obj)
+	if !ok || changed.getName() != k.configMapName {
+		return
+	}
+
+	k.Lock()
+	defer k.Unlock()
+
+	k.setCache(changed)
+}
+
+func (k *Manager) onObjectDeleted(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	deleted, ok := k.store.convert(obj)
+	if !ok || deleted.getName() != k.configMapName {
+		return
+	}
+
+	k.Lock()
+	defer k.Unlock()
+
+	// The next write will create the object again.
+	k.object = nil
+	k.internalCache = map[string][]byte{}
+}
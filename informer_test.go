@@ -0,0 +1,77 @@
+package mapstore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInformerSeesExternalWrites(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := NewWithInformer(storeTestName)
+	assert.NoError(t, err)
+	t.Cleanup(kv.Close)
+
+	other, err := New(storeTestName, false)
+	assert.NoError(t, err)
+	assert.NoError(t, other.Set("hello", []byte("world")))
+
+	assert.Eventually(t, func() bool {
+		val, err := kv.Get("hello")
+		return err == nil && string(val) == "world"
+	}, time.Second, 10*time.Millisecond)
+
+	// Our own writes still work with the informer running.
+	assert.NoError(t, kv.Set("foo", []byte("bar")))
+
+	data, err := other.Raw()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"hello": []byte("world"), "foo": []byte("bar")}, data)
+}
+
+func TestInformerSeesExternalDelete(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := NewWithInformer(storeTestName)
+	assert.NoError(t, err)
+	t.Cleanup(kv.Close)
+
+	assert.NoError(t, kv.Set("hello", []byte("world")))
+	assert.NoError(t, kv.client.delete(kv.ctx, storeTestName))
+
+	assert.Eventually(t, func() bool {
+		_, err := kv.Get("hello")
+		return err == ErrKeyNotFound
+	}, time.Second, 10*time.Millisecond)
+
+	// Writing again recreates the ConfigMap.
+	assert.NoError(t, kv.Set("foo", []byte("bar")))
+
+	data, err := kv.client.get(kv.ctx, storeTestName)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"foo": []byte("bar")}, data)
+}
+
+func TestInformerIgnoresOtherConfigMaps(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := NewWithInformer(storeTestName)
+	assert.NoError(t, err)
+	t.Cleanup(kv.Close)
+
+	assert.NoError(t, kv.Set("hello", []byte("world")))
+	assert.NoError(t, kv.client.set(kv.ctx, "some-other-name", map[string][]byte{"foo": []byte("bar")}))
+
+	// Give the informer a moment to deliver the unrelated event.
+	time.Sleep(50 * time.Millisecond)
+
+	data, err := kv.Raw()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"hello": []byte("world")}, data)
+
+	// Closing twice is fine.
+	kv.Close()
+	kv.Close()
+}
@@ -0,0 +1,124 @@
+package mapstore
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ErrInvalidKey is returned when a key can not be stored in a ConfigMap, because it is empty, too long, contains
+// characters other than `[-._a-zA-Z0-9]` or is reserved by this package. Use WithKeyEncoding to store any key.
+var ErrInvalidKey = fmt.Errorf("key is not a valid configmap key")
+
+// reservedKeyPrefix is the prefix of the keys this package keeps its own data under, such as expiryKey.
+const reservedKeyPrefix = ".mapstore."
+
+// keyEscape starts an escaped byte in an encoded key, and is followed by the byte as two hex digits.
+const keyEscape = '_'
+
+// storedKey returns the key as it is stored in the ConfigMap.
+func (k *Manager) storedKey(key string) string {
+	if !k.keyEncoding {
+		return key
+	}
+
+	return encodeKey(key)
+}
+
+// userKey reverses storedKey for a key read from the ConfigMap.
+func (k *Manager) userKey(stored string) string {
+	if !k.keyEncoding {
+		return stored
+	}
+
+	return decodeKey(stored)
+}
+
+// userData returns the data with its keys turned back into the keys the user set them with.
+func (k *Manager) userData(data map[string][]byte) map[string][]byte {
+	if !k.keyEncoding {
+		return data
+	}
+
+	result := make(map[string][]byte, len(data))
+	for key, value := range data {
+		result[decodeKey(key)] = value
+	}
+
+	return result
+}
+
+// checkKey returns the stored form of a key that is about to be written, or an error matching ErrInvalidKey if the
+// API server would reject it.
+func (k *Manager) checkKey(key string) (string, error) {
+	stored := k.storedKey(key)
+	if err := ValidateKey(stored); err != nil {
+		return "", err
+	}
+
+	return stored, nil
+}
+
+// ValidateKey returns an error matching ErrInvalidKey if the key can not be stored in a ConfigMap as is, or is reserved
+// by this package.
+func ValidateKey(key string) error {
+	if strings.HasPrefix(key, reservedKeyPrefix) {
+		return fmt.Errorf("%w: %q is reserved", ErrInvalidKey, key)
+	}
+
+	if errs := validation.IsConfigMapKey(key); len(errs) > 0 {
+		return fmt.Errorf("%w: %q: %s", ErrInvalidKey, key, strings.Join(errs, ", "))
+	}
+
+	return nil
+}
+
+// encodeKey escapes every byte of the key that is not allowed in a ConfigMap key, along with the escape character
+// itself and a leading dot (so "." and ".." are escaped, and keys can't collide with the reserved keys).
+func encodeKey(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		if c := key[i]; isKeyChar(c) && (c != '.' || i > 0) {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%c%02X", keyEscape, c)
+		}
+	}
+
+	return b.String()
+}
+
+// decodeKey reverses encodeKey. Keys that are not validly encoded (as written without key encoding) are returned as is.
+func decodeKey(stored string) string {
+	if !strings.ContainsRune(stored, keyEscape) {
+		return stored
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(stored); i++ {
+		if stored[i] != keyEscape {
+			b.WriteByte(stored[i])
+			continue
+		}
+
+		if i+3 > len(stored) {
+			return stored
+		}
+
+		c, err := strconv.ParseUint(stored[i+1:i+3], 16, 8)
+		if err != nil {
+			return stored
+		}
+
+		b.WriteByte(byte(c))
+		i += 2
+	}
+
+	return b.String()
+}
+
+func isKeyChar(c byte) bool {
+	return c == '-' || c == '.' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
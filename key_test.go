@@ -0,0 +1,130 @@
+package mapstore
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyValidation(t *testing.T) {
+	client := setFakeKubeClient(t)
+
+	kv, err := New(storeTestName, false)
+	assert.NoError(t, err)
+
+	for _, key := range []string{"", ".", "..", "user/42", "tenant:foo", "ключ", strings.Repeat("a", 254), expiryKey} {
+		assert.True(t, errors.Is(kv.Set(key, []byte("value")), ErrInvalidKey), key)
+	}
+
+	// Nothing was sent to the API server.
+	assert.Empty(t, client.Actions())
+
+	assert.NoError(t, kv.Set("valid-key_1.txt", []byte("value")))
+	assert.NoError(t, kv.Set(strings.Repeat("a", 253), []byte("value")))
+
+	// Every write path checks the keys.
+	assert.True(t, errors.Is(kv.ForceSet("a/b", nil), ErrInvalidKey))
+	assert.True(t, errors.Is(kv.SetMany(map[string][]byte{"ok": nil, "a/b": nil}), ErrInvalidKey))
+	assert.True(t, errors.Is(kv.Update("a/b", func([]byte, bool) ([]byte, error) { return nil, nil }), ErrInvalidKey))
+
+	_, err = kv.CompareAndSwap("a/b", nil, nil)
+	assert.True(t, errors.Is(err, ErrInvalidKey))
+	_, err = kv.SetIfAbsent("a/b", nil)
+	assert.True(t, errors.Is(err, ErrInvalidKey))
+	_, err = kv.Txn().Then(OpSet("a/b", nil)).Commit()
+	assert.True(t, errors.Is(err, ErrInvalidKey))
+
+	// Reads and deletes of invalid keys simply find nothing.
+	_, err = kv.Get("a/b")
+	assert.Equal(t, ErrKeyNotFound, err)
+	assert.NoError(t, kv.Delete("a/b"))
+
+	keys, err := kv.Keys()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"valid-key_1.txt", strings.Repeat("a", 253)}, keys)
+}
+
+func TestKeyEncoding(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := NewWithOptions(storeTestName, WithKeyEncoding())
+	assert.NoError(t, err)
+
+	keys := []string{"user/42", "tenant:foo", "ключ", "under_score", ".", "..", expiryKey, "plain.key"}
+	for _, key := range keys {
+		assert.NoError(t, kv.Set(key, []byte(key)), key)
+	}
+
+	got, err := kv.Keys()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, keys, got)
+
+	for _, key := range keys {
+		val, err := kv.Get(key)
+		assert.NoError(t, err, key)
+		assert.Equal(t, []byte(key), val)
+	}
+
+	raw, err := kv.Raw()
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("user/42"), raw["user/42"])
+
+	many, err := kv.GetMany([]string{"user/42", "missing"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"user/42": []byte("user/42")}, many)
+
+	// The stored keys are valid ConfigMap keys.
+	stored, err := kv.client.get(kv.ctx, storeTestName)
+	assert.NoError(t, err)
+	assert.Contains(t, stored, "user_2F42")
+	assert.Contains(t, stored, "under_5Fscore")
+	assert.Contains(t, stored, "_2E.")
+	assert.Contains(t, stored, "plain.key")
+
+	succeeded, err := kv.Txn().If(Equal("tenant:foo", []byte("tenant:foo"))).Then(OpDelete("user/42")).Commit()
+	assert.NoError(t, err)
+	assert.True(t, succeeded)
+
+	assert.NoError(t, kv.DeleteMany([]string{"tenant:foo", "ключ"}))
+	_, err = kv.Get("tenant:foo")
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// Keys that still don't fit are rejected.
+	assert.True(t, errors.Is(kv.Set("", nil), ErrInvalidKey))
+	assert.True(t, errors.Is(kv.Set(strings.Repeat("/", 100), nil), ErrInvalidKey))
+}
+
+func TestKeyEncodingWatch(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := NewWithOptions(storeTestName, WithKeyEncoding())
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	events, err := kv.Watch(ctx, "user/")
+	assert.NoError(t, err)
+
+	assert.NoError(t, kv.Set("other", []byte("1")))
+	assert.NoError(t, kv.Set("user/42", []byte("2")))
+
+	event := <-events
+	assert.Equal(t, EventPut, event.Type)
+	assert.Equal(t, "user/42", event.Key)
+}
+
+func TestKeyEncodeDecode(t *testing.T) {
+	for _, key := range []string{"", "simple", "a/b", "_", "__2F", ".hidden", "with space", "日本"} {
+		assert.Equal(t, key, decodeKey(encodeKey(key)), key)
+	}
+
+	assert.Equal(t, "_2Ehidden.txt", encodeKey(".hidden.txt"))
+
+	// Keys that were not encoded are returned as is.
+	assert.Equal(t, "my_key", decodeKey("my_key"))
+	assert.Equal(t, "trailing_", decodeKey("trailing_"))
+}
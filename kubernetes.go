@@ -2,14 +2,19 @@ package mapstore
 
 import (
 	"context"
+	"fmt"
 	"os"
 
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth" // Import auth for local cluster configs.
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
@@ -67,13 +72,13 @@ func getKubeClient() (*kubeClient, error) {
 	return singleton, nil
 }
 
-func (k *kubeClient) getConfigMap(name string) (*corev1.ConfigMap, error) {
-	return k.client.CoreV1().ConfigMaps(k.namespace).Get(k.ctx, name, v1.GetOptions{})
+func (k *kubeClient) getConfigMap(ctx context.Context, name string) (*corev1.ConfigMap, error) {
+	return k.client.CoreV1().ConfigMaps(k.namespace).Get(ctx, name, v1.GetOptions{})
 }
 
-func (k *kubeClient) getOrCreateConfigMap(name string) (*corev1.ConfigMap, error) {
+func (k *kubeClient) getOrCreateConfigMap(ctx context.Context, name string) (*corev1.ConfigMap, error) {
 	// Attempt to fetch the existing ConfigMap.
-	cm, err := k.client.CoreV1().ConfigMaps(k.namespace).Get(k.ctx, name, v1.GetOptions{})
+	cm, err := k.client.CoreV1().ConfigMaps(k.namespace).Get(ctx, name, v1.GetOptions{})
 
 	// If no error was returned and we have valid ConfigMap, return it.
 	if err == nil && cm != nil {
@@ -86,18 +91,11 @@ func (k *kubeClient) getOrCreateConfigMap(name string) (*corev1.ConfigMap, error
 	}
 
 	// Looks like we need to create the ConfigMap.
-	cm = &corev1.ConfigMap{
-		ObjectMeta: v1.ObjectMeta{
-			Name:      name,
-			Namespace: k.namespace,
-		},
-	}
-
-	return k.client.CoreV1().ConfigMaps(k.namespace).Create(k.ctx, cm, v1.CreateOptions{})
+	return k.create(ctx, name, nil)
 }
 
-func (k *kubeClient) get(name string) (map[string][]byte, error) {
-	cm, err := k.getConfigMap(name)
+func (k *kubeClient) get(ctx context.Context, name string) (map[string][]byte, error) {
+	cm, err := k.getConfigMap(ctx, name)
 	if err != nil {
 		return nil, err
 	}
@@ -105,15 +103,21 @@ func (k *kubeClient) get(name string) (map[string][]byte, error) {
 	return cm.BinaryData, err
 }
 
-func (k *kubeClient) set(name string, binaryData map[string][]byte) error {
+func (k *kubeClient) set(ctx context.Context, name string, binaryData map[string][]byte) error {
 	// Attempt to update if it exists.
-	if cm, err := k.getConfigMap(name); err == nil {
+	if cm, err := k.getConfigMap(ctx, name); err == nil {
 		cm.BinaryData = binaryData
-		_, updateErr := k.client.CoreV1().ConfigMaps(k.namespace).Update(k.ctx, cm, v1.UpdateOptions{})
+		_, updateErr := k.update(ctx, cm)
 		return updateErr
 	}
 
 	// Doesn't exists, create it instead.
+	_, err := k.create(ctx, name, binaryData)
+
+	return err
+}
+
+func (k *kubeClient) create(ctx context.Context, name string, binaryData map[string][]byte) (*corev1.ConfigMap, error) {
 	cm := &corev1.ConfigMap{
 		ObjectMeta: v1.ObjectMeta{
 			Name:      name,
@@ -122,13 +126,17 @@ func (k *kubeClient) set(name string, binaryData map[string][]byte) error {
 		BinaryData: binaryData,
 	}
 
-	_, err := k.client.CoreV1().ConfigMaps(k.namespace).Create(k.ctx, cm, v1.CreateOptions{})
+	return k.client.CoreV1().ConfigMaps(k.namespace).Create(ctx, cm, v1.CreateOptions{})
+}
 
-	return err
+// update writes the given ConfigMap. The API server rejects the write with a conflict if the ResourceVersion of the
+// ConfigMap is no longer current.
+func (k *kubeClient) update(ctx context.Context, cm *corev1.ConfigMap) (*corev1.ConfigMap, error) {
+	return k.client.CoreV1().ConfigMaps(k.namespace).Update(ctx, cm, v1.UpdateOptions{})
 }
 
-func (k *kubeClient) delete(name string) error {
-	err := k.client.CoreV1().ConfigMaps(k.namespace).Delete(k.ctx, name, v1.DeleteOptions{})
+func (k *kubeClient) delete(ctx context.Context, name string) error {
+	err := k.client.CoreV1().ConfigMaps(k.namespace).Delete(ctx, name, v1.DeleteOptions{})
 
 	// We can safely ignore not found errors.
 	if statusError, ok := err.(*errors.StatusError); ok && statusError.Status().Reason == v1.StatusReasonNotFound {
@@ -137,3 +145,32 @@ func (k *kubeClient) delete(name string) error {
 
 	return err
 }
+
+// watchConfigMap starts a watch on the named ConfigMap for changes after the given resourceVersion.
+func (k *kubeClient) watchConfigMap(ctx context.Context, name, resourceVersion string) (watch.Interface, error) {
+	return k.client.CoreV1().ConfigMaps(k.namespace).Watch(ctx, v1.ListOptions{
+		FieldSelector:   fields.OneTermEqualSelector("metadata.name", name).String(),
+		ResourceVersion: resourceVersion,
+	})
+}
+
+// informObject starts a shared informer (as returned by newInformer) that only watches the named object, and blocks
+// until its initial list has been delivered to the handler. The informer runs until stopCh is closed.
+func (k *kubeClient) informObject(name string, newInformer func(informers.SharedInformerFactory) cache.SharedIndexInformer, handler cache.ResourceEventHandler, stopCh <-chan struct{}) error {
+	factory := informers.NewSharedInformerFactoryWithOptions(k.client, 0,
+		informers.WithNamespace(k.namespace),
+		informers.WithTweakListOptions(func(opts *v1.ListOptions) {
+			opts.FieldSelector = fields.OneTermEqualSelector("metadata.name", name).String()
+		}),
+	)
+
+	informer := newInformer(factory)
+	informer.AddEventHandler(handler)
+	factory.Start(stopCh)
+
+	if !cache.WaitForCacheSync(stopCh, informer.HasSynced) {
+		return fmt.Errorf("informer for %s did not sync", name)
+	}
+
+	return nil
+}
@@ -3,12 +3,17 @@ package mapstore
 import (
 	"context"
 	"os"
+	"strconv"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 const (
@@ -20,6 +25,42 @@ func fakeKubernetesClient() *kubeClient {
 	return &kubeClient{fake.NewSimpleClientset(), context.Background(), k8sTestNamespace}
 }
 
+// newFakeClientset returns a fake clientset that assigns and checks ResourceVersions on ConfigMaps and Secrets like
+// the API server.
+func newFakeClientset() *fake.Clientset {
+	client := fake.NewSimpleClientset()
+	version := 0
+
+	reactor := func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetVerb() != "create" && action.GetVerb() != "update" {
+			return false, nil, nil
+		}
+
+		obj, err := meta.Accessor(action.(k8stesting.CreateAction).GetObject())
+		if err != nil {
+			return false, nil, nil
+		}
+
+		if action.GetVerb() == "update" {
+			existing, err := client.Tracker().Get(action.GetResource(), action.GetNamespace(), obj.GetName())
+			if err == nil && existing.(v1.Object).GetResourceVersion() != obj.GetResourceVersion() {
+				return true, nil, errors.NewConflict(action.GetResource().GroupResource(), obj.GetName(), nil)
+			}
+		}
+
+		// Hand off to the default object tracker with the new version.
+		version++
+		obj.SetResourceVersion(strconv.Itoa(version))
+
+		return false, nil, nil
+	}
+
+	client.PrependReactor("*", "configmaps", reactor)
+	client.PrependReactor("*", "secrets", reactor)
+
+	return client
+}
+
 func TestKubernetesSingleton(t *testing.T) {
 	t.Cleanup(func() { singleton = nil })
 	assert.Nil(t, singleton)
@@ -48,7 +89,7 @@ func TestKubernetesGetConfigMap(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Now try fetching the ConfigMap.
-	cm, err := kc.getConfigMap(k8sTestName)
+	cm, err := kc.getConfigMap(kc.ctx, k8sTestName)
 	assert.NoError(t, err)
 	assert.NotNil(t, cm)
 	assert.Equal(t, "bar", string(cm.BinaryData["foo"]))
@@ -58,7 +99,7 @@ func TestKubernetesGetConfigMapError(t *testing.T) {
 	kc := fakeKubernetesClient()
 
 	// Now try fetching the ConfigMap.
-	cm, err := kc.getConfigMap(k8sTestName)
+	cm, err := kc.getConfigMap(kc.ctx, k8sTestName)
 	assert.Error(t, err)
 	assert.Nil(t, cm)
 }
@@ -75,7 +116,7 @@ func TestKubernetesGet(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Now try fetching the ConfigMap.
-	result, err := kc.get(k8sTestName)
+	result, err := kc.get(kc.ctx, k8sTestName)
 	assert.NoError(t, err)
 	assert.NotNil(t, result)
 	assert.Equal(t, data, result)
@@ -85,7 +126,7 @@ func TestKubernetesGetError(t *testing.T) {
 	kc := fakeKubernetesClient()
 
 	// Now try fetching the ConfigMap.
-	result, err := kc.get(k8sTestName)
+	result, err := kc.get(kc.ctx, k8sTestName)
 	assert.Error(t, err)
 	assert.Nil(t, result)
 }
@@ -94,13 +135,13 @@ func TestKubernetesGetOrCreateWithNoConfigMap(t *testing.T) {
 	kc := fakeKubernetesClient()
 
 	// Now try fetching the ConfigMap.
-	result, err := kc.getOrCreateConfigMap(k8sTestName)
+	result, err := kc.getOrCreateConfigMap(kc.ctx, k8sTestName)
 	assert.NoError(t, err)
 	assert.NotNil(t, result)
 	assert.Empty(t, result.BinaryData)
 
 	// Create a ConfigMap that we can fetch.
-	cm, err := kc.getConfigMap(k8sTestName)
+	cm, err := kc.getConfigMap(kc.ctx, k8sTestName)
 	assert.NoError(t, err)
 	assert.NotNil(t, cm)
 	assert.Empty(t, cm.BinaryData)
@@ -118,7 +159,7 @@ func TestKubernetesGetOrCreateWithExistingConfigMap(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Now try fetching the ConfigMap.
-	result, err := kc.getOrCreateConfigMap(k8sTestName)
+	result, err := kc.getOrCreateConfigMap(kc.ctx, k8sTestName)
 	assert.NoError(t, err)
 	assert.NotNil(t, result)
 	assert.Equal(t, data, result.BinaryData)
@@ -128,11 +169,11 @@ func TestKubernetesSetCreate(t *testing.T) {
 	data := map[string][]byte{"foo": []byte("bar")}
 	kc := fakeKubernetesClient()
 
-	err := kc.set(k8sTestName, data)
+	err := kc.set(kc.ctx, k8sTestName, data)
 	assert.NoError(t, err)
 
 	// Now try fetching the ConfigMap.
-	result, err := kc.get(k8sTestName)
+	result, err := kc.get(kc.ctx, k8sTestName)
 	assert.NoError(t, err)
 	assert.NotNil(t, result)
 	assert.Equal(t, data, result)
@@ -150,16 +191,34 @@ func TestKubernetesSetUpdate(t *testing.T) {
 	assert.NoError(t, err)
 
 	newData := map[string][]byte{"foo": []byte("bar"), "num": []byte("one")}
-	err = kc.set(k8sTestName, newData)
+	err = kc.set(kc.ctx, k8sTestName, newData)
 	assert.NoError(t, err)
 
 	// Now try fetching the ConfigMap.
-	result, err := kc.get(k8sTestName)
+	result, err := kc.get(kc.ctx, k8sTestName)
 	assert.NoError(t, err)
 	assert.NotNil(t, result)
 	assert.Equal(t, newData, result)
 }
 
+func TestKubernetesUpdateConflict(t *testing.T) {
+	kc := &kubeClient{newFakeClientset(), context.Background(), k8sTestNamespace}
+
+	cm, err := kc.create(kc.ctx, k8sTestName, map[string][]byte{"foo": []byte("bar")})
+	assert.NoError(t, err)
+
+	// The first update with the current version succeeds.
+	stale := cm.DeepCopy()
+	cm.BinaryData = map[string][]byte{"foo": []byte("baz")}
+	_, err = kc.update(kc.ctx, cm)
+	assert.NoError(t, err)
+
+	// The same version can not be used twice.
+	stale.BinaryData = map[string][]byte{"foo": []byte("qux")}
+	_, err = kc.update(kc.ctx, stale)
+	assert.True(t, errors.IsConflict(err))
+}
+
 func TestKubernetesDelete(t *testing.T) {
 	kc := fakeKubernetesClient()
 
@@ -171,13 +230,13 @@ func TestKubernetesDelete(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Now try fetching the ConfigMap.
-	err = kc.delete(k8sTestName)
+	err = kc.delete(kc.ctx, k8sTestName)
 	assert.NoError(t, err)
 }
 
 func TestKubernetesDeleteError(t *testing.T) {
 	kc := fakeKubernetesClient()
 
-	err := kc.delete(k8sTestName)
+	err := kc.delete(kc.ctx, k8sTestName)
 	assert.NoError(t, err)
 }
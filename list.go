@@ -0,0 +1,89 @@
+package mapstore
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// ListOptions selects the keys returned by List.
+type ListOptions struct {
+	// Prefix only returns keys that start with it.
+	Prefix string
+	// StartAfter only returns keys that sort after it. Pass the Continue token of the previous page to get the next one.
+	StartAfter string
+	// Limit is the maximum number of items to return, or zero for all of them.
+	Limit int
+}
+
+// KeyValue is a single key and its value.
+type KeyValue struct {
+	Key   string
+	Value []byte
+}
+
+// ListResult is a page of items returned by List, sorted by key.
+type ListResult struct {
+	Items []KeyValue
+	// Continue is set when there are more items after this page, and can be passed as ListOptions.StartAfter to get
+	// them. It is the key of the last item.
+	Continue string
+}
+
+// List returns the keys and values selected by the options, sorted by key. All keys and values come from a single read
+// of the ConfigMap.
+func (k *Manager) List(opts ListOptions) (*ListResult, error) {
+	return k.ListContext(k.ctx, opts)
+}
+
+// ListContext is the same as List, but uses the given context for the API calls.
+func (k *Manager) ListContext(ctx context.Context, opts ListOptions) (*ListResult, error) {
+	k.RLock()
+	defer k.RUnlock()
+
+	// Grab the data map.
+	dataMap, err := k.getMapData(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the values on the page are decoded.
+	stored := make(map[string]string, len(dataMap))
+	keys := make([]string, 0, len(dataMap))
+	for key := range dataMap {
+		stored[k.userKey(key)] = key
+		keys = append(keys, k.userKey(key))
+	}
+
+	keys, cont := listKeys(keys, opts)
+	result := &ListResult{Items: make([]KeyValue, 0, len(keys)), Continue: cont}
+
+	for _, key := range keys {
+		value, err := k.decodeValue(ctx, stored[key], dataMap[stored[key]])
+		if err != nil {
+			return nil, err
+		}
+
+		result.Items = append(result.Items, KeyValue{key, value})
+	}
+
+	return result, nil
+}
+
+// listKeys returns the keys that are selected by the options in sorted order, and the continue token of the page.
+func listKeys(keys []string, opts ListOptions) ([]string, string) {
+	result := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if strings.HasPrefix(key, opts.Prefix) && key > opts.StartAfter {
+			result = append(result, key)
+		}
+	}
+
+	sort.Strings(result)
+
+	if opts.Limit <= 0 || len(result) <= opts.Limit {
+		return result, ""
+	}
+
+	return result[:opts.Limit], result[opts.Limit-1]
+}
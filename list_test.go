@@ -0,0 +1,100 @@
+package mapstore
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListPages(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := NewWithOptions(storeTestName, WithCompression(Gzip))
+	assert.NoError(t, err)
+
+	for i := 9; i >= 0; i-- {
+		assert.NoError(t, kv.Set(fmt.Sprintf("user.%d", i), []byte(fmt.Sprint(i))))
+	}
+	assert.NoError(t, kv.Set("other", []byte("x")))
+
+	var keys []string
+	opts := ListOptions{Prefix: "user.", Limit: 4}
+	for pages := 1; ; pages++ {
+		result, err := kv.List(opts)
+		assert.NoError(t, err)
+
+		for _, item := range result.Items {
+			keys = append(keys, item.Key)
+			assert.Equal(t, []byte(item.Key[len("user."):]), item.Value)
+		}
+
+		if result.Continue == "" {
+			assert.Equal(t, 3, pages)
+			break
+		}
+
+		opts.StartAfter = result.Continue
+	}
+
+	assert.Equal(t, []string{"user.0", "user.1", "user.2", "user.3", "user.4", "user.5", "user.6", "user.7", "user.8", "user.9"}, keys)
+
+	// Without options, everything is returned in order.
+	result, err := kv.List(ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, result.Items, 11)
+	assert.Equal(t, "other", result.Items[0].Key)
+	assert.Empty(t, result.Continue)
+
+	// A limit that exactly fits has no continue token.
+	result, err = kv.List(ListOptions{Prefix: "user.", Limit: 10})
+	assert.NoError(t, err)
+	assert.Len(t, result.Items, 10)
+	assert.Empty(t, result.Continue)
+}
+
+func TestListKeyEncoding(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := NewWithOptions(storeTestName, WithKeyEncoding())
+	assert.NoError(t, err)
+
+	assert.NoError(t, kv.Set("tenant/b", []byte("2")))
+	assert.NoError(t, kv.Set("tenant/a", []byte("1")))
+	assert.NoError(t, kv.Set("tenant_c", []byte("3")))
+
+	result, err := kv.List(ListOptions{Prefix: "tenant/"})
+	assert.NoError(t, err)
+	assert.Equal(t, []KeyValue{{"tenant/a", []byte("1")}, {"tenant/b", []byte("2")}}, result.Items)
+}
+
+func TestListSharded(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := NewSharded(storeTestName, 3)
+	assert.NoError(t, err)
+
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, kv.Set(fmt.Sprintf("key-%02d", i), []byte(fmt.Sprint(i))))
+	}
+
+	var items []KeyValue
+	opts := ListOptions{Limit: 7}
+	for {
+		result, err := kv.List(opts)
+		assert.NoError(t, err)
+		items = append(items, result.Items...)
+
+		if result.Continue == "" {
+			break
+		}
+
+		opts.StartAfter = result.Continue
+	}
+
+	assert.Len(t, items, 20)
+	for i, item := range items {
+		assert.Equal(t, fmt.Sprintf("key-%02d", i), item.Key)
+		assert.Equal(t, []byte(fmt.Sprint(i)), item.Value)
+	}
+}
@@ -0,0 +1,416 @@
+// Package mapstoretest checks that implementations of mapstore.Interface behave like a mapstore.Manager.
+//
+//	func TestConformance(t *testing.T) {
+//	    mapstoretest.RunConformance(t, func(t *testing.T) mapstore.Interface {
+//	        return myStore()
+//	    })
+//	}
+package mapstoretest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/unrolled/mapstore"
+)
+
+// Factory returns a new, empty store for a single test.
+type Factory func(t *testing.T) mapstore.Interface
+
+// RunConformance runs the conformance tests as subtests of t, calling factory for a new store in each of them. The
+// tests of mapstore.AdvancedInterface are skipped if the store does not implement it.
+func RunConformance(t *testing.T, factory Factory) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, store mapstore.Interface)
+	}{
+		{"GetMissing", testGetMissing},
+		{"SetGet", testSetGet},
+		{"Overwrite", testOverwrite},
+		{"SetDuplicate", testSetDuplicate},
+		{"Keys", testKeys},
+		{"Delete", testDelete},
+		{"Truncate", testTruncate},
+		{"BinaryValues", testBinaryValues},
+		{"LargeValue", testLargeValue},
+		{"InvalidKeys", testInvalidKeys},
+		{"Concurrency", testConcurrency},
+	}
+
+	advancedTests := []struct {
+		name string
+		fn   func(t *testing.T, store mapstore.AdvancedInterface)
+	}{
+		{"Raw", testRaw},
+		{"ForceSet", testForceSet},
+		{"CompareAndSwap", testCompareAndSwap},
+		{"SetIfAbsent", testSetIfAbsent},
+		{"Batch", testBatch},
+		{"ConcurrentSetIfAbsent", testConcurrentSetIfAbsent},
+		{"ConcurrentCompareAndSwap", testConcurrentCompareAndSwap},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			test.fn(t, factory(t))
+		})
+	}
+
+	for _, test := range advancedTests {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			store, ok := factory(t).(mapstore.AdvancedInterface)
+			if !ok {
+				t.Skip("store does not implement mapstore.AdvancedInterface")
+			}
+
+			test.fn(t, store)
+		})
+	}
+}
+
+func testGetMissing(t *testing.T, store mapstore.Interface) {
+	_, err := store.Get("missing")
+	assert.True(t, errors.Is(err, mapstore.ErrKeyNotFound), "got %v", err)
+
+	keys, err := store.Keys()
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
+func testSetGet(t *testing.T, store mapstore.Interface) {
+	assert.NoError(t, store.Set("hello", []byte("world")))
+
+	val, err := store.Get("hello")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("world"), val)
+}
+
+func testOverwrite(t *testing.T, store mapstore.Interface) {
+	assert.NoError(t, store.Set("hello", []byte("world")))
+	assert.NoError(t, store.Set("hello", []byte("there")))
+
+	val, err := store.Get("hello")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("there"), val)
+}
+
+func testSetDuplicate(t *testing.T, store mapstore.Interface) {
+	assert.NoError(t, store.Set("hello", []byte("world")))
+	assert.NoError(t, store.Set("hello", []byte("world")))
+
+	val, err := store.Get("hello")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("world"), val)
+
+	keys, err := store.Keys()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"hello"}, keys)
+}
+
+func testKeys(t *testing.T, store mapstore.Interface) {
+	want := []string{"a", "b.c", "d-e", "f_g", "H1"}
+	for _, key := range want {
+		assert.NoError(t, store.Set(key, []byte(key)))
+	}
+
+	keys, err := store.Keys()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, want, keys)
+}
+
+func testDelete(t *testing.T, store mapstore.Interface) {
+	assert.NoError(t, store.Set("hello", []byte("world")))
+	assert.NoError(t, store.Set("foo", []byte("bar")))
+	assert.NoError(t, store.Delete("hello"))
+
+	_, err := store.Get("hello")
+	assert.True(t, errors.Is(err, mapstore.ErrKeyNotFound), "got %v", err)
+
+	keys, err := store.Keys()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"foo"}, keys)
+
+	// Deleting a key that does not exist is not an error.
+	assert.NoError(t, store.Delete("hello"))
+	assert.NoError(t, store.Delete("never-existed"))
+}
+
+func testTruncate(t *testing.T, store mapstore.Interface) {
+	// Truncating an empty store is fine.
+	assert.NoError(t, store.Truncate())
+
+	for i := 0; i < 5; i++ {
+		assert.NoError(t, store.Set(fmt.Sprintf("key-%d", i), []byte("value")))
+	}
+
+	assert.NoError(t, store.Truncate())
+
+	keys, err := store.Keys()
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+
+	_, err = store.Get("key-0")
+	assert.True(t, errors.Is(err, mapstore.ErrKeyNotFound), "got %v", err)
+
+	// The store is still usable afterwards.
+	assert.NoError(t, store.Set("hello", []byte("world")))
+	val, err := store.Get("hello")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("world"), val)
+}
+
+func testBinaryValues(t *testing.T, store mapstore.Interface) {
+	values := map[string][]byte{
+		"nulls":     {0, 0, 0},
+		"high":      {0xff, 0xfe, 0x80},
+		"header-z":  []byte("\x00msz\x01not really compressed"),
+		"header-e":  []byte("\x00mse\x01not really encrypted"),
+		"header-c":  []byte("\x00msc{}"),
+		"newlines":  []byte("one\ntwo\r\n"),
+		"unicode":   []byte("ключ 日本"),
+		"one-byte":  {'x'},
+		"long-line": bytes.Repeat([]byte("0123456789"), 100),
+	}
+
+	for key, value := range values {
+		assert.NoError(t, store.Set(key, value), key)
+	}
+
+	for key, value := range values {
+		val, err := store.Get(key)
+		assert.NoError(t, err, key)
+		assert.Equal(t, value, val, key)
+	}
+}
+
+func testLargeValue(t *testing.T, store mapstore.Interface) {
+	value := make([]byte, 256*1024)
+	for i := range value {
+		value[i] = byte(i * 7)
+	}
+
+	assert.NoError(t, store.Set("large", value))
+
+	val, err := store.Get("large")
+	assert.NoError(t, err)
+	assert.True(t, bytes.Equal(value, val), "large value did not round trip")
+}
+
+func testInvalidKeys(t *testing.T, store mapstore.Interface) {
+	// A store either accepts a key and returns it unchanged, or rejects it with mapstore.ErrInvalidKey.
+	for _, key := range []string{"user/42", "tenant:foo", "with space", "ключ", ".."} {
+		err := store.Set(key, []byte("value"))
+		if err != nil {
+			assert.True(t, errors.Is(err, mapstore.ErrInvalidKey), "key %q: got %v", key, err)
+			continue
+		}
+
+		val, err := store.Get(key)
+		assert.NoError(t, err, key)
+		assert.Equal(t, []byte("value"), val, key)
+
+		keys, err := store.Keys()
+		assert.NoError(t, err)
+		assert.Contains(t, keys, key)
+
+		assert.NoError(t, store.Delete(key), key)
+	}
+
+	// The empty key is never valid.
+	assert.Error(t, store.Set("", []byte("value")))
+}
+
+func testConcurrency(t *testing.T, store mapstore.Interface) {
+	const writers = 8
+
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			key := fmt.Sprintf("writer-%d", i)
+			assert.NoError(t, store.Set(key, []byte(key)))
+
+			_, err := store.Keys()
+			assert.NoError(t, err)
+		}(i)
+	}
+
+	wg.Wait()
+
+	keys, err := store.Keys()
+	assert.NoError(t, err)
+	assert.Len(t, keys, writers)
+
+	for i := 0; i < writers; i++ {
+		key := fmt.Sprintf("writer-%d", i)
+		val, err := store.Get(key)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte(key), val)
+	}
+}
+
+func testRaw(t *testing.T, store mapstore.AdvancedInterface) {
+	raw, err := store.Raw()
+	assert.NoError(t, err)
+	assert.Empty(t, raw)
+
+	assert.NoError(t, store.Set("hello", []byte("world")))
+	assert.NoError(t, store.Set("foo", []byte("bar")))
+
+	raw, err = store.Raw()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"hello": []byte("world"), "foo": []byte("bar")}, raw)
+}
+
+func testForceSet(t *testing.T, store mapstore.AdvancedInterface) {
+	assert.NoError(t, store.ForceSet("hello", []byte("world")))
+	assert.NoError(t, store.ForceSet("hello", []byte("world")))
+
+	val, err := store.Get("hello")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("world"), val)
+}
+
+func testCompareAndSwap(t *testing.T, store mapstore.AdvancedInterface) {
+	// A missing key is never swapped.
+	swapped, err := store.CompareAndSwap("key", nil, []byte("a"))
+	assert.NoError(t, err)
+	assert.False(t, swapped)
+
+	_, err = store.Get("key")
+	assert.True(t, errors.Is(err, mapstore.ErrKeyNotFound), "got %v", err)
+
+	assert.NoError(t, store.Set("key", []byte("a")))
+
+	swapped, err = store.CompareAndSwap("key", []byte("b"), []byte("c"))
+	assert.NoError(t, err)
+	assert.False(t, swapped)
+
+	swapped, err = store.CompareAndSwap("key", []byte("a"), []byte("c"))
+	assert.NoError(t, err)
+	assert.True(t, swapped)
+
+	// Swapping to the same value still reports a swap.
+	swapped, err = store.CompareAndSwap("key", []byte("c"), []byte("c"))
+	assert.NoError(t, err)
+	assert.True(t, swapped)
+
+	val, err := store.Get("key")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("c"), val)
+}
+
+func testSetIfAbsent(t *testing.T, store mapstore.AdvancedInterface) {
+	set, err := store.SetIfAbsent("key", []byte("a"))
+	assert.NoError(t, err)
+	assert.True(t, set)
+
+	set, err = store.SetIfAbsent("key", []byte("b"))
+	assert.NoError(t, err)
+	assert.False(t, set)
+
+	val, err := store.Get("key")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("a"), val)
+}
+
+func testBatch(t *testing.T, store mapstore.AdvancedInterface) {
+	assert.NoError(t, store.SetMany(map[string][]byte{"one": []byte("1"), "two": []byte("2"), "three": []byte("3")}))
+
+	many, err := store.GetMany([]string{"one", "three", "missing"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"one": []byte("1"), "three": []byte("3")}, many)
+
+	// Unchanged values are left alone.
+	assert.NoError(t, store.SetMany(map[string][]byte{"one": []byte("1"), "two": []byte("22")}))
+
+	assert.NoError(t, store.DeleteMany([]string{"one", "missing"}))
+
+	raw, err := store.Raw()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"two": []byte("22"), "three": []byte("3")}, raw)
+
+	many, err = store.GetMany(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, many)
+}
+
+func testConcurrentSetIfAbsent(t *testing.T, store mapstore.AdvancedInterface) {
+	const claimers = 8
+
+	var wg sync.WaitGroup
+	wins := make(chan int, claimers)
+
+	for i := 0; i < claimers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			set, err := store.SetIfAbsent("claim", []byte(fmt.Sprint(i)))
+			assert.NoError(t, err)
+			if set {
+				wins <- i
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	close(wins)
+
+	// Exactly one claim wins, and its value is the one stored.
+	var winners []int
+	for i := range wins {
+		winners = append(winners, i)
+	}
+
+	if assert.Len(t, winners, 1) {
+		val, err := store.Get("claim")
+		assert.NoError(t, err)
+		assert.Equal(t, []byte(fmt.Sprint(winners[0])), val)
+	}
+}
+
+func testConcurrentCompareAndSwap(t *testing.T, store mapstore.AdvancedInterface) {
+	const claimers = 8
+
+	assert.NoError(t, store.Set("claim", []byte("free")))
+
+	var wg sync.WaitGroup
+	wins := make(chan int, claimers)
+
+	for i := 0; i < claimers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			swapped, err := store.CompareAndSwap("claim", []byte("free"), []byte(fmt.Sprint(i)))
+			assert.NoError(t, err)
+			if swapped {
+				wins <- i
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	close(wins)
+
+	// Every claim swaps from the same old value, but only one of them can win.
+	var winners []int
+	for i := range wins {
+		winners = append(winners, i)
+	}
+
+	if assert.Len(t, winners, 1) {
+		val, err := store.Get("claim")
+		assert.NoError(t, err)
+		assert.Equal(t, []byte(fmt.Sprint(winners[0])), val)
+	}
+}
@@ -0,0 +1,292 @@
+// Package memstore provides an in-memory implementation of mapstore.Interface and mapstore.AdvancedInterface, for
+// tests and local development without a cluster. It behaves like a mapstore.Manager: missing keys return
+// mapstore.ErrKeyNotFound, invalid keys return mapstore.ErrInvalidKey and writes that would grow the data past
+// mapstore.MaxSize return a *mapstore.SizeLimitError.
+package memstore
+
+import (
+	"bytes"
+	"sync"
+
+	"github.com/unrolled/mapstore"
+)
+
+// Verify we meet the requirements for the mapstore interfaces.
+var _ mapstore.Interface = &Store{}
+var _ mapstore.AdvancedInterface = &Store{}
+
+// Store keeps the key value pairs in memory. It is safe for concurrent use.
+type Store struct {
+	*sync.RWMutex
+	data        map[string][]byte
+	anyKey      bool
+	ignoreLimit bool
+}
+
+// Option configures a Store created with New.
+type Option func(*Store)
+
+// AllowAnyKey accepts keys that are not valid ConfigMap keys, like a Manager created with mapstore.WithKeyEncoding.
+func AllowAnyKey() Option {
+	return func(s *Store) {
+		s.anyKey = true
+	}
+}
+
+// WithoutSizeLimit allows the data to grow past mapstore.MaxSize, like a Manager that chunks or shards its data.
+func WithoutSizeLimit() Option {
+	return func(s *Store) {
+		s.ignoreLimit = true
+	}
+}
+
+// New returns an empty Store.
+func New(opts ...Option) *Store {
+	s := &Store{RWMutex: &sync.RWMutex{}, data: map[string][]byte{}}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// Keys returns all the key names.
+func (s *Store) Keys() ([]string, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	keys := make([]string, 0, len(s.data))
+	for key := range s.data {
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// Get returns the value of the key, or mapstore.ErrKeyNotFound.
+func (s *Store) Get(key string) ([]byte, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	val, ok := s.data[key]
+	if !ok {
+		return nil, mapstore.ErrKeyNotFound
+	}
+
+	return copyValue(val), nil
+}
+
+// GetMany looks up all the given keys. Keys that do not exist are left out of the result.
+func (s *Store) GetMany(keys []string) (map[string][]byte, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	result := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		if val, ok := s.data[key]; ok {
+			result[key] = copyValue(val)
+		}
+	}
+
+	return result, nil
+}
+
+// Raw returns a copy of all the data.
+func (s *Store) Raw() (map[string][]byte, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	result := make(map[string][]byte, len(s.data))
+	for key, val := range s.data {
+		result[key] = copyValue(val)
+	}
+
+	return result, nil
+}
+
+// Set sets the value of the key. Nothing changes if the value is the same.
+func (s *Store) Set(key string, value []byte) error {
+	return s.SetMany(map[string][]byte{key: value})
+}
+
+// ForceSet is the same as Set. It exists for parity with mapstore.Manager, where it skips the equality check.
+func (s *Store) ForceSet(key string, value []byte) error {
+	return s.Set(key, value)
+}
+
+// SetMany sets all the given values at once.
+func (s *Store) SetMany(values map[string][]byte) error {
+	for key := range values {
+		if err := s.checkKey(key); err != nil {
+			return err
+		}
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	return s.mutate(func(data map[string][]byte) bool {
+		changed := false
+		for key, value := range values {
+			if ogValue, ok := data[key]; ok && bytes.Equal(ogValue, value) {
+				continue
+			}
+
+			data[key] = copyValue(value)
+			changed = true
+		}
+
+		return changed
+	})
+}
+
+// CompareAndSwap sets the key to new only if it currently holds old, and reports whether the value was swapped.
+func (s *Store) CompareAndSwap(key string, old, new []byte) (bool, error) {
+	if err := s.checkKey(key); err != nil {
+		return false, err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	swapped := false
+	err := s.mutate(func(data map[string][]byte) bool {
+		ogValue, ok := data[key]
+		swapped = ok && bytes.Equal(ogValue, old)
+
+		if !swapped || bytes.Equal(old, new) {
+			return false
+		}
+
+		data[key] = copyValue(new)
+
+		return true
+	})
+
+	return swapped && err == nil, err
+}
+
+// SetIfAbsent sets the key only if it does not exist yet, and reports whether the value was set.
+func (s *Store) SetIfAbsent(key string, value []byte) (bool, error) {
+	if err := s.checkKey(key); err != nil {
+		return false, err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	set := false
+	err := s.mutate(func(data map[string][]byte) bool {
+		_, exists := data[key]
+		if !exists {
+			data[key] = copyValue(value)
+		}
+
+		set = !exists
+
+		return set
+	})
+
+	return set && err == nil, err
+}
+
+// Update calls fn with the current value of the key and stores the value it returns. Returning an error from fn aborts
+// the update and the error is passed through.
+func (s *Store) Update(key string, fn func(old []byte, exists bool) ([]byte, error)) error {
+	if err := s.checkKey(key); err != nil {
+		return err
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	ogValue, exists := s.data[key]
+
+	value, err := fn(copyValue(ogValue), exists)
+	if err != nil {
+		return err
+	}
+
+	return s.mutate(func(data map[string][]byte) bool {
+		if exists && bytes.Equal(ogValue, value) {
+			return false
+		}
+
+		data[key] = copyValue(value)
+
+		return true
+	})
+}
+
+// Delete removes the key. Deleting a key that does not exist is not an error.
+func (s *Store) Delete(key string) error {
+	return s.DeleteMany([]string{key})
+}
+
+// DeleteMany removes all the given keys.
+func (s *Store) DeleteMany(keys []string) error {
+	s.Lock()
+	defer s.Unlock()
+
+	for _, key := range keys {
+		delete(s.data, key)
+	}
+
+	return nil
+}
+
+// Truncate removes all the data.
+func (s *Store) Truncate() error {
+	s.Lock()
+	defer s.Unlock()
+
+	s.data = map[string][]byte{}
+
+	return nil
+}
+
+// mutate applies fn to a copy of the data, and keeps the result if fn changed it and it fits. The caller must hold the
+// write lock.
+func (s *Store) mutate(fn func(data map[string][]byte) bool) error {
+	data := make(map[string][]byte, len(s.data))
+	for key, val := range s.data {
+		data[key] = val
+	}
+
+	if !fn(data) {
+		return nil
+	}
+
+	if projected := size(data); projected > mapstore.MaxSize && !s.ignoreLimit {
+		return &mapstore.SizeLimitError{Current: size(s.data), Projected: projected}
+	}
+
+	s.data = data
+
+	return nil
+}
+
+func (s *Store) checkKey(key string) error {
+	if s.anyKey {
+		return nil
+	}
+
+	return mapstore.ValidateKey(key)
+}
+
+func size(data map[string][]byte) int {
+	size := 0
+	for key, val := range data {
+		size += len(key) + len(val)
+	}
+
+	return size
+}
+
+func copyValue(value []byte) []byte {
+	if value == nil {
+		return nil
+	}
+
+	return append([]byte{}, value...)
+}
@@ -0,0 +1,135 @@
+package memstore
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/unrolled/mapstore"
+)
+
+func TestStoreBasics(t *testing.T) {
+	s := New()
+
+	_, err := s.Get("missing")
+	assert.Equal(t, mapstore.ErrKeyNotFound, err)
+
+	assert.NoError(t, s.Set("hello", []byte("world")))
+	assert.NoError(t, s.Set("foo", []byte("bar")))
+
+	val, err := s.Get("hello")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("world"), val)
+
+	keys, err := s.Keys()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"hello", "foo"}, keys)
+
+	assert.NoError(t, s.Delete("hello"))
+	assert.NoError(t, s.Delete("hello"))
+	_, err = s.Get("hello")
+	assert.Equal(t, mapstore.ErrKeyNotFound, err)
+
+	assert.NoError(t, s.Truncate())
+	keys, err = s.Keys()
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
+func TestStoreValuesAreCopied(t *testing.T) {
+	s := New()
+
+	value := []byte("original")
+	assert.NoError(t, s.Set("key", value))
+	value[0] = 'X'
+
+	got, err := s.Get("key")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("original"), got)
+
+	got[0] = 'Y'
+	raw, err := s.Raw()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"key": []byte("original")}, raw)
+}
+
+func TestStoreAdvanced(t *testing.T) {
+	s := New()
+
+	set, err := s.SetIfAbsent("lock", []byte("a"))
+	assert.NoError(t, err)
+	assert.True(t, set)
+
+	set, err = s.SetIfAbsent("lock", []byte("b"))
+	assert.NoError(t, err)
+	assert.False(t, set)
+
+	swapped, err := s.CompareAndSwap("lock", []byte("b"), []byte("c"))
+	assert.NoError(t, err)
+	assert.False(t, swapped)
+
+	swapped, err = s.CompareAndSwap("lock", []byte("a"), []byte("c"))
+	assert.NoError(t, err)
+	assert.True(t, swapped)
+
+	swapped, err = s.CompareAndSwap("missing", nil, []byte("c"))
+	assert.NoError(t, err)
+	assert.False(t, swapped)
+
+	assert.NoError(t, s.SetMany(map[string][]byte{"one": []byte("1"), "two": []byte("2")}))
+
+	many, err := s.GetMany([]string{"one", "two", "missing"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"one": []byte("1"), "two": []byte("2")}, many)
+
+	assert.NoError(t, s.Update("one", func(old []byte, exists bool) ([]byte, error) {
+		assert.True(t, exists)
+		return append(old, '1'), nil
+	}))
+
+	val, err := s.Get("one")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("11"), val)
+
+	boom := errors.New("boom")
+	assert.Equal(t, boom, s.Update("one", func([]byte, bool) ([]byte, error) { return nil, boom }))
+
+	assert.NoError(t, s.DeleteMany([]string{"one", "two"}))
+	keys, err := s.Keys()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"lock"}, keys)
+}
+
+func TestStoreKeyValidation(t *testing.T) {
+	s := New()
+
+	assert.True(t, errors.Is(s.Set("user/42", nil), mapstore.ErrInvalidKey))
+	assert.True(t, errors.Is(s.Set(".mapstore.expiry", nil), mapstore.ErrInvalidKey))
+
+	_, err := s.SetIfAbsent("user/42", nil)
+	assert.True(t, errors.Is(err, mapstore.ErrInvalidKey))
+
+	s = New(AllowAnyKey())
+	assert.NoError(t, s.Set("user/42", []byte("ok")))
+}
+
+func TestStoreSizeLimit(t *testing.T) {
+	s := New()
+
+	assert.NoError(t, s.Set("small", []byte("value")))
+
+	err := s.Set("big", bytes.Repeat([]byte("a"), mapstore.MaxSize))
+	assert.True(t, errors.Is(err, mapstore.ErrSizeLimitExceeded))
+
+	var sizeErr *mapstore.SizeLimitError
+	assert.True(t, errors.As(err, &sizeErr))
+	assert.Equal(t, len("small")+len("value"), sizeErr.Current)
+
+	// Nothing was written.
+	_, err = s.Get("big")
+	assert.Equal(t, mapstore.ErrKeyNotFound, err)
+
+	s = New(WithoutSizeLimit())
+	assert.NoError(t, s.Set("big", bytes.Repeat([]byte("a"), mapstore.MaxSize)))
+}
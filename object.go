@@ -0,0 +1,141 @@
+package mapstore
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+// object is the Kubernetes object (a ConfigMap or a Secret) that holds the data of a Manager.
+type object interface {
+	getName() string
+	getResourceVersion() string
+	getData() map[string][]byte
+	// withData returns a copy of the object that holds the given data instead.
+	withData(data map[string][]byte) object
+	// size counts the given data along with any other data the object holds, the same way as MaxSize.
+	size(data map[string][]byte) int
+}
+
+// objectStore reads and writes the objects that hold the data of a Manager.
+type objectStore interface {
+	get(ctx context.Context, name string) (object, error)
+	getOrCreate(ctx context.Context, name string) (object, error)
+	create(ctx context.Context, name string, data map[string][]byte) (object, error)
+	update(ctx context.Context, obj object) (object, error)
+	delete(ctx context.Context, name string) error
+	watch(ctx context.Context, name, resourceVersion string) (watch.Interface, error)
+	inform(name string, handler cache.ResourceEventHandler, stopCh <-chan struct{}) error
+	// convert returns the object from a watch or informer event, if it is one of ours.
+	convert(obj interface{}) (object, bool)
+}
+
+type configMapObject struct {
+	*corev1.ConfigMap
+}
+
+func (c configMapObject) getName() string {
+	return c.Name
+}
+
+func (c configMapObject) getResourceVersion() string {
+	return c.ResourceVersion
+}
+
+func (c configMapObject) getData() map[string][]byte {
+	return c.BinaryData
+}
+
+func (c configMapObject) withData(data map[string][]byte) object {
+	cm := c.DeepCopy()
+	cm.BinaryData = data
+
+	return configMapObject{cm}
+}
+
+func (c configMapObject) size(data map[string][]byte) int {
+	size := 0
+	for key, val := range c.Data {
+		size += len(key) + len(val)
+	}
+
+	return size + dataSize(data)
+}
+
+// configMapStore keeps the data in the BinaryData of ConfigMaps.
+type configMapStore struct {
+	*kubeClient
+}
+
+func (s configMapStore) get(ctx context.Context, name string) (object, error) {
+	return s.wrap(s.getConfigMap(ctx, name))
+}
+
+func (s configMapStore) getOrCreate(ctx context.Context, name string) (object, error) {
+	return s.wrap(s.getOrCreateConfigMap(ctx, name))
+}
+
+func (s configMapStore) create(ctx context.Context, name string, data map[string][]byte) (object, error) {
+	return s.wrap(s.kubeClient.create(ctx, name, data))
+}
+
+func (s configMapStore) update(ctx context.Context, obj object) (object, error) {
+	return s.wrap(s.kubeClient.update(ctx, obj.(configMapObject).ConfigMap))
+}
+
+func (s configMapStore) delete(ctx context.Context, name string) error {
+	return s.kubeClient.delete(ctx, name)
+}
+
+func (s configMapStore) watch(ctx context.Context, name, resourceVersion string) (watch.Interface, error) {
+	return s.watchConfigMap(ctx, name, resourceVersion)
+}
+
+func (s configMapStore) inform(name string, handler cache.ResourceEventHandler, stopCh <-chan struct{}) error {
+	return s.informObject(name, func(f informers.SharedInformerFactory) cache.SharedIndexInformer {
+		return f.Core().V1().ConfigMaps().Informer()
+	}, handler, stopCh)
+}
+
+func (s configMapStore) convert(obj interface{}) (object, bool) {
+	cm, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		return nil, false
+	}
+
+	return configMapObject{cm}, true
+}
+
+func (s configMapStore) wrap(cm *corev1.ConfigMap, err error) (object, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	return configMapObject{cm}, nil
+}
+
+// saveObject writes the data to the named object, creating it if it does not exist yet. Unlike a Manager write, this
+// overwrites whatever the object held.
+func saveObject(ctx context.Context, store objectStore, name string, data map[string][]byte) error {
+	obj, err := store.get(ctx, name)
+	if err == nil {
+		_, err = store.update(ctx, obj.withData(data))
+	} else if isNotFound(err) {
+		_, err = store.create(ctx, name, data)
+	}
+
+	return err
+}
+
+// dataSize adds up the length of every key and value.
+func dataSize(data map[string][]byte) int {
+	size := 0
+	for key, val := range data {
+		size += len(key) + len(val)
+	}
+
+	return size
+}
@@ -0,0 +1,232 @@
+package mapstore
+
+import (
+	"context"
+	"time"
+
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// Option configures a Manager created with NewWithOptions or a ManagerFactory.
+type Option func(*options)
+
+type options struct {
+	clientset       kubernetes.Interface
+	restConfig      *rest.Config
+	kubeconfigPath  string
+	namespace       string
+	ctx             context.Context
+	cacheEnabled    bool
+	informer        bool
+	keyEncoding     bool
+	compressor      Compressor
+	keyProvider     KeyProvider
+	chunkSize       int
+	janitorInterval time.Duration
+	secrets         bool
+}
+
+// WithClientset uses the given Kubernetes client instead of connecting to the cluster from the environment.
+func WithClientset(clientset kubernetes.Interface) Option {
+	return func(o *options) {
+		o.clientset = clientset
+	}
+}
+
+// WithRESTConfig connects to the cluster described by the given config.
+func WithRESTConfig(config *rest.Config) Option {
+	return func(o *options) {
+		o.restConfig = config
+	}
+}
+
+// WithKubeconfigPath connects to the cluster described by the current context of the kubeconfig file at the given path.
+// Unless WithNamespace is given, the namespace of that context is used.
+func WithKubeconfigPath(path string) Option {
+	return func(o *options) {
+		o.kubeconfigPath = path
+	}
+}
+
+// WithNamespace stores the ConfigMap in the given namespace instead of the namespace found in the environment.
+func WithNamespace(namespace string) Option {
+	return func(o *options) {
+		o.namespace = namespace
+	}
+}
+
+// WithContext sets the context used for the API calls of methods that don't take one (such as Get and Set).
+func WithContext(ctx context.Context) Option {
+	return func(o *options) {
+		o.ctx = ctx
+	}
+}
+
+// WithCache holds the ConfigMap data in memory, see the cacheInternally argument of New.
+func WithCache(enabled bool) Option {
+	return func(o *options) {
+		o.cacheEnabled = enabled
+	}
+}
+
+// WithInformer holds the ConfigMap data in memory and keeps it in sync using an informer, see NewWithInformer.
+func WithInformer() Option {
+	return func(o *options) {
+		o.informer = true
+	}
+}
+
+// WithKeyEncoding allows any key (such as `user/42` or `tenant:foo`) by escaping the bytes that are not allowed in a
+// ConfigMap key as `_XX` hex before the key is stored. Keys are returned unescaped, so they round trip unchanged.
+func WithKeyEncoding() Option {
+	return func(o *options) {
+		o.keyEncoding = true
+	}
+}
+
+// WithCompression compresses values with the given Compressor (such as Gzip) before they are written. Values that
+// don't get smaller are stored as is, and values written without compression can still be read.
+func WithCompression(c Compressor) Option {
+	return func(o *options) {
+		o.compressor = c
+	}
+}
+
+// WithEncryption encrypts every value with AES-256-GCM before it is written. Each value gets its own data key, which is
+// wrapped by the given KeyProvider and stored along with the ID of the key that wrapped it. Values are compressed
+// before they are encrypted.
+func WithEncryption(provider KeyProvider) Option {
+	return func(o *options) {
+		o.keyProvider = provider
+	}
+}
+
+// WithChunking stores values that are larger than chunkSize bytes (after compression) in separate chunk ConfigMaps
+// named `<configMapName>-chunk-<id>-<n>`, so the ConfigMap name must leave room for that. Only a small manifest with
+// a checksum is kept under the key itself. Use DefaultChunkSize unless you have a reason not to.
+func WithChunking(chunkSize int) Option {
+	return func(o *options) {
+		o.chunkSize = chunkSize
+	}
+}
+
+// WithJanitor removes expired keys (see SetWithTTL) from the ConfigMap every interval in the background, instead of
+// leaving them until the next write. Call Close to stop the janitor when the Manager is no longer needed.
+func WithJanitor(interval time.Duration) Option {
+	return func(o *options) {
+		o.janitorInterval = interval
+	}
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return o
+}
+
+// objectStore returns where the data of a Manager is kept.
+func (o *options) objectStore(client *kubeClient) objectStore {
+	if o.secrets {
+		return secretStore{client}
+	}
+
+	return configMapStore{client}
+}
+
+// kubeClient returns the client described by the options. Without any connection options, the shared client that is
+// configured from the environment is used.
+func (o *options) kubeClient() (*kubeClient, error) {
+	if !o.hasConnection() {
+		return o.sharedKubeClient()
+	}
+
+	clientset, err := o.newClientset()
+	if err != nil {
+		return nil, err
+	}
+
+	// Fall back to the namespace of the kubeconfig context, or else the namespace from the environment.
+	namespace := o.namespace
+	if namespace == "" && o.usesKubeconfig() {
+		if namespace, _, err = o.kubeconfig().Namespace(); err != nil {
+			return nil, err
+		}
+	} else if namespace == "" {
+		if namespace, err = getNamespace(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &kubeClient{clientset, o.context(), namespace}, nil
+}
+
+// hasConnection reports if any of the options describe how to connect to the cluster.
+func (o *options) hasConnection() bool {
+	return o.clientset != nil || o.restConfig != nil || o.kubeconfigPath != ""
+}
+
+// usesKubeconfig reports if the connection is made using the kubeconfig file, as the other connection options take
+// precedence over it.
+func (o *options) usesKubeconfig() bool {
+	return o.clientset == nil && o.restConfig == nil && o.kubeconfigPath != ""
+}
+
+// kubeconfig returns the client config of the current context of the kubeconfig file.
+func (o *options) kubeconfig() clientcmd.ClientConfig {
+	rules := &clientcmd.ClientConfigLoadingRules{ExplicitPath: o.kubeconfigPath}
+
+	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{})
+}
+
+// newClientset returns the clientset described by the connection options.
+func (o *options) newClientset() (kubernetes.Interface, error) {
+	switch {
+	case o.clientset != nil:
+		return o.clientset, nil
+	case o.restConfig != nil:
+		return kubernetes.NewForConfig(o.restConfig)
+	default:
+		config, err := o.kubeconfig().ClientConfig()
+		if err != nil {
+			return nil, err
+		}
+
+		return kubernetes.NewForConfig(config)
+	}
+}
+
+func (o *options) context() context.Context {
+	if o.ctx == nil {
+		return context.Background()
+	}
+
+	return o.ctx
+}
+
+// sharedKubeClient returns the singleton client, copied if the namespace or context are overridden.
+func (o *options) sharedKubeClient() (*kubeClient, error) {
+	client, err := getKubeClient()
+	if err != nil {
+		return nil, err
+	}
+
+	if o.namespace == "" && o.ctx == nil {
+		return client, nil
+	}
+
+	copied := *client
+	if o.namespace != "" {
+		copied.namespace = o.namespace
+	}
+
+	if o.ctx != nil {
+		copied.ctx = o.ctx
+	}
+
+	return &copied, nil
+}
@@ -0,0 +1,92 @@
+package mapstore
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/rest"
+)
+
+type optionsTestKey struct{}
+
+func TestOptionsWithClientset(t *testing.T) {
+	client := newFakeClientset()
+
+	kv, err := NewWithOptions(storeTestName, WithClientset(client), WithNamespace("custom-ns"), WithCache(true))
+	assert.NoError(t, err)
+	assert.True(t, kv.cacheEnabled)
+	assert.NoError(t, kv.Set("hello", []byte("world")))
+
+	// The ConfigMap should live in the requested namespace.
+	kc := &kubeClient{client, context.Background(), "custom-ns"}
+	data, err := kc.get(kc.ctx, storeTestName)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"hello": []byte("world")}, data)
+}
+
+func TestOptionsWithContext(t *testing.T) {
+	ctx := context.WithValue(context.Background(), optionsTestKey{}, "yes")
+
+	kv, err := NewWithOptions(storeTestName, WithClientset(newFakeClientset()), WithNamespace("ns"), WithContext(ctx))
+	assert.NoError(t, err)
+	assert.Equal(t, ctx, kv.ctx)
+	assert.Equal(t, ctx, kv.client.ctx)
+}
+
+func TestOptionsNamespaceFromEnv(t *testing.T) {
+	os.Setenv(namespaceEnv, "env-ns")
+	t.Cleanup(func() { os.Unsetenv(namespaceEnv) })
+
+	kv, err := NewWithOptions(storeTestName, WithClientset(newFakeClientset()))
+	assert.NoError(t, err)
+	assert.Equal(t, "env-ns", kv.client.namespace)
+	assert.False(t, kv.cacheEnabled)
+}
+
+func TestOptionsWithKubeconfigPath(t *testing.T) {
+	kv, err := NewWithOptions(storeTestName, WithKubeconfigPath("./testdata/config.yaml"), WithNamespace("ns"))
+	assert.NoError(t, err)
+	assert.NotNil(t, kv.client.client)
+	assert.Nil(t, singleton)
+}
+
+func TestOptionsNamespaceFromKubeconfig(t *testing.T) {
+	os.Setenv(namespaceEnv, "env-ns")
+	t.Cleanup(func() { os.Unsetenv(namespaceEnv) })
+
+	// The namespace of the kubeconfig context wins over the environment...
+	kv, err := NewWithOptions(storeTestName, WithKubeconfigPath("./testdata/config-namespace.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, "kubeconfig-ns", kv.client.namespace)
+
+	// ...but not over WithNamespace.
+	kv, err = NewWithOptions(storeTestName, WithKubeconfigPath("./testdata/config-namespace.yaml"), WithNamespace("ns"))
+	assert.NoError(t, err)
+	assert.Equal(t, "ns", kv.client.namespace)
+
+	// A context without a namespace uses the default namespace, like kubectl does.
+	kv, err = NewWithOptions(storeTestName, WithKubeconfigPath("./testdata/config.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, "default", kv.client.namespace)
+}
+
+func TestOptionsWithRESTConfig(t *testing.T) {
+	kv, err := NewWithOptions(storeTestName, WithRESTConfig(&rest.Config{Host: "https://localhost:6443"}), WithNamespace("ns"))
+	assert.NoError(t, err)
+	assert.NotNil(t, kv.client.client)
+	assert.Nil(t, singleton)
+}
+
+func TestOptionsSharedClientWithNamespace(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := NewWithOptions(storeTestName, WithNamespace("other-ns"))
+	assert.NoError(t, err)
+	assert.Equal(t, "other-ns", kv.client.namespace)
+	assert.Equal(t, singleton.client, kv.client.client)
+
+	// The singleton itself is left alone.
+	assert.Equal(t, storeTestNamespace, singleton.namespace)
+}
@@ -0,0 +1,124 @@
+package mapstore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Verify we meet the requirements for our own interfaces.
+var _ Interface = &prefixedManager{}
+
+// prefixedManager is a view of the keys of a Manager that start with a prefix.
+type prefixedManager struct {
+	manager *Manager
+	prefix  string
+}
+
+// WithPrefix returns a view of the keys that start with the given prefix. The view adds the prefix to every key it is
+// given and strips it from the keys it returns, so several components can share a ConfigMap without knowing about each
+// other. Truncate only removes the keys with the prefix.
+func (k *Manager) WithPrefix(prefix string) Interface {
+	return &prefixedManager{k, prefix}
+}
+
+// prefixedKey returns the key with the prefix added. The empty key is rejected, as it would be the prefix itself.
+func (p *prefixedManager) prefixedKey(key string) (string, error) {
+	if key == "" {
+		return "", fmt.Errorf("%w: the key must not be empty", ErrInvalidKey)
+	}
+
+	return p.prefix + key, nil
+}
+
+// Keys returns the keys that start with the prefix, without the prefix.
+func (p *prefixedManager) Keys() ([]string, error) {
+	return p.KeysContext(p.manager.ctx)
+}
+
+// KeysContext is the same as Keys, but uses the given context for the API calls.
+func (p *prefixedManager) KeysContext(ctx context.Context) ([]string, error) {
+	keys, err := p.manager.KeysContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0, len(keys))
+	for _, key := range keys {
+		if strings.HasPrefix(key, p.prefix) {
+			result = append(result, strings.TrimPrefix(key, p.prefix))
+		}
+	}
+
+	return result, nil
+}
+
+// Get returns the value of the prefixed key.
+func (p *prefixedManager) Get(key string) ([]byte, error) {
+	return p.GetContext(p.manager.ctx, key)
+}
+
+// GetContext is the same as Get, but uses the given context for the API calls.
+func (p *prefixedManager) GetContext(ctx context.Context, key string) ([]byte, error) {
+	key, err := p.prefixedKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.manager.GetContext(ctx, key)
+}
+
+// Set sets the value of the prefixed key.
+func (p *prefixedManager) Set(key string, value []byte) error {
+	return p.SetContext(p.manager.ctx, key, value)
+}
+
+// SetContext is the same as Set, but uses the given context for the API calls.
+func (p *prefixedManager) SetContext(ctx context.Context, key string, value []byte) error {
+	key, err := p.prefixedKey(key)
+	if err != nil {
+		return err
+	}
+
+	return p.manager.SetContext(ctx, key, value)
+}
+
+// Delete removes the prefixed key.
+func (p *prefixedManager) Delete(key string) error {
+	return p.DeleteContext(p.manager.ctx, key)
+}
+
+// DeleteContext is the same as Delete, but uses the given context for the API calls.
+func (p *prefixedManager) DeleteContext(ctx context.Context, key string) error {
+	key, err := p.prefixedKey(key)
+	if err != nil {
+		return err
+	}
+
+	return p.manager.DeleteContext(ctx, key)
+}
+
+// Truncate removes every key that starts with the prefix with a single write, leaving all other keys alone.
+func (p *prefixedManager) Truncate() error {
+	return p.TruncateContext(p.manager.ctx)
+}
+
+// TruncateContext is the same as Truncate, but uses the given context for the API calls.
+func (p *prefixedManager) TruncateContext(ctx context.Context) error {
+	k := p.manager
+
+	k.Lock()
+	defer k.Unlock()
+
+	return k.mutate(ctx, false, func(data map[string][]byte) (bool, error) {
+		changed := false
+		for key := range data {
+			if strings.HasPrefix(k.userKey(key), p.prefix) {
+				delete(data, key)
+				changed = true
+			}
+		}
+
+		return changed, nil
+	})
+}
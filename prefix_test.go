@@ -0,0 +1,95 @@
+package mapstore
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefixView(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := New(storeTestName, true)
+	assert.NoError(t, err)
+
+	billing := kv.WithPrefix("billing.")
+	auth := kv.WithPrefix("auth.")
+
+	assert.NoError(t, billing.Set("rate", []byte("10")))
+	assert.NoError(t, auth.Set("rate", []byte("20")))
+	assert.NoError(t, kv.Set("global", []byte("30")))
+
+	val, err := billing.Get("rate")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("10"), val)
+
+	val, err = kv.Get("auth.rate")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("20"), val)
+
+	keys, err := billing.Keys()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"rate"}, keys)
+
+	_, err = billing.Get("global")
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	assert.NoError(t, auth.Delete("rate"))
+	_, err = auth.Get("rate")
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	// Truncate leaves the keys outside the prefix alone.
+	assert.NoError(t, billing.Set("limit", []byte("5")))
+	assert.NoError(t, auth.Set("token", []byte("abc")))
+	assert.NoError(t, billing.Truncate())
+
+	keys, err = billing.Keys()
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+
+	keys, err = kv.Keys()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"auth.token", "global"}, keys)
+}
+
+func TestPrefixKeyEncoding(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := NewWithOptions(storeTestName, WithKeyEncoding())
+	assert.NoError(t, err)
+
+	tenant := kv.WithPrefix("tenant/foo/")
+	assert.NoError(t, tenant.Set("user:42", []byte("bar")))
+	assert.NoError(t, kv.Set("tenant/bar/user:42", []byte("baz")))
+
+	keys, err := tenant.Keys()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"user:42"}, keys)
+
+	assert.NoError(t, tenant.Truncate())
+
+	keys, err = kv.Keys()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tenant/bar/user:42"}, keys)
+}
+
+func TestPrefixEmptyKey(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := New(storeTestName, false)
+	assert.NoError(t, err)
+	assert.NoError(t, kv.Set("app.", []byte("not in the view")))
+
+	view := kv.WithPrefix("app.")
+
+	// The empty key would be the prefix itself.
+	assert.True(t, errors.Is(view.Set("", []byte("value")), ErrInvalidKey))
+	_, err = view.Get("")
+	assert.True(t, errors.Is(err, ErrInvalidKey))
+	assert.True(t, errors.Is(view.Delete(""), ErrInvalidKey))
+
+	val, err := kv.Get("app.")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("not in the view"), val)
+}
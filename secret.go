@@ -0,0 +1,148 @@
+package mapstore
+
+import (
+	"context"
+
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+)
+
+var _ Interface = &SecretManager{}
+var _ AdvancedInterface = &SecretManager{}
+var _ ContextInterface = &SecretManager{}
+
+// SecretManager is a Manager that keeps its data in the Data of a Secret instead of a ConfigMap. Everything else,
+// including caching, no-op writes and errors, behaves the same as a Manager.
+type SecretManager struct {
+	*Manager
+}
+
+// NewSecret returns a newly setup SecretManager instance for the named Secret.
+func NewSecret(secretName string, cacheInternally bool) (*SecretManager, error) {
+	return NewSecretWithOptions(secretName, WithCache(cacheInternally))
+}
+
+// NewSecretWithOptions returns a newly setup SecretManager instance configured by the given options.
+func NewSecretWithOptions(secretName string, opts ...Option) (*SecretManager, error) {
+	o := newOptions(opts)
+	o.secrets = true
+
+	kubeClient, err := o.kubeClient()
+	if err != nil {
+		return nil, err
+	}
+
+	m, err := newManager(secretName, kubeClient, o)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SecretManager{m}, nil
+}
+
+type secretObject struct {
+	*corev1.Secret
+}
+
+func (s secretObject) getName() string {
+	return s.Name
+}
+
+func (s secretObject) getResourceVersion() string {
+	return s.ResourceVersion
+}
+
+func (s secretObject) getData() map[string][]byte {
+	return s.Data
+}
+
+func (s secretObject) withData(data map[string][]byte) object {
+	secret := s.DeepCopy()
+	secret.Data = data
+
+	return secretObject{secret}
+}
+
+func (s secretObject) size(data map[string][]byte) int {
+	return dataSize(data)
+}
+
+// secretStore keeps the data in the Data of Opaque Secrets.
+type secretStore struct {
+	*kubeClient
+}
+
+func (s secretStore) get(ctx context.Context, name string) (object, error) {
+	return s.wrap(s.client.CoreV1().Secrets(s.namespace).Get(ctx, name, v1.GetOptions{}))
+}
+
+func (s secretStore) getOrCreate(ctx context.Context, name string) (object, error) {
+	obj, err := s.get(ctx, name)
+	if err == nil || !isNotFound(err) {
+		return obj, err
+	}
+
+	return s.create(ctx, name, nil)
+}
+
+func (s secretStore) create(ctx context.Context, name string, data map[string][]byte) (object, error) {
+	secret := &corev1.Secret{
+		ObjectMeta: v1.ObjectMeta{
+			Name:      name,
+			Namespace: s.namespace,
+		},
+		Type: corev1.SecretTypeOpaque,
+		Data: data,
+	}
+
+	return s.wrap(s.client.CoreV1().Secrets(s.namespace).Create(ctx, secret, v1.CreateOptions{}))
+}
+
+func (s secretStore) update(ctx context.Context, obj object) (object, error) {
+	return s.wrap(s.client.CoreV1().Secrets(s.namespace).Update(ctx, obj.(secretObject).Secret, v1.UpdateOptions{}))
+}
+
+func (s secretStore) delete(ctx context.Context, name string) error {
+	err := s.client.CoreV1().Secrets(s.namespace).Delete(ctx, name, v1.DeleteOptions{})
+
+	// We can safely ignore not found errors.
+	if isNotFound(err) {
+		return nil
+	}
+
+	return err
+}
+
+func (s secretStore) watch(ctx context.Context, name, resourceVersion string) (watch.Interface, error) {
+	return s.client.CoreV1().Secrets(s.namespace).Watch(ctx, v1.ListOptions{
+		FieldSelector:   fields.OneTermEqualSelector("metadata.name", name).String(),
+		ResourceVersion: resourceVersion,
+	})
+}
+
+func (s secretStore) inform(name string, handler cache.ResourceEventHandler, stopCh <-chan struct{}) error {
+	return s.informObject(name, func(f informers.SharedInformerFactory) cache.SharedIndexInformer {
+		return f.Core().V1().Secrets().Informer()
+	}, handler, stopCh)
+}
+
+func (s secretStore) convert(obj interface{}) (object, bool) {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		return nil, false
+	}
+
+	return secretObject{secret}, true
+}
+
+func (s secretStore) wrap(secret *corev1.Secret, err error) (object, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	return secretObject{secret}, nil
+}
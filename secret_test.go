@@ -0,0 +1,124 @@
+package mapstore
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSecretSetGetDelete(t *testing.T) {
+	client := setFakeKubeClient(t)
+
+	kv, err := NewSecret(storeTestName, false)
+	assert.NoError(t, err)
+
+	assert.NoError(t, kv.Set("token", []byte("s3cr3t")))
+
+	val, err := kv.Get("token")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("s3cr3t"), val)
+
+	// The data lives in a Secret, not a ConfigMap.
+	secret, err := client.CoreV1().Secrets(storeTestNamespace).Get(context.Background(), storeTestName, v1.GetOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, corev1.SecretTypeOpaque, secret.Type)
+	assert.Equal(t, []byte("s3cr3t"), secret.Data["token"])
+
+	_, err = client.CoreV1().ConfigMaps(storeTestNamespace).Get(context.Background(), storeTestName, v1.GetOptions{})
+	assert.True(t, isNotFound(err))
+
+	assert.NoError(t, kv.Delete("token"))
+	_, err = kv.Get("token")
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestSecretCache(t *testing.T) {
+	client := setFakeKubeClient(t)
+
+	kv, err := NewSecret(storeTestName, true)
+	assert.NoError(t, err)
+	assert.NoError(t, kv.Set("token", []byte("s3cr3t")))
+
+	// No-op writes are checked against the API server, but never written.
+	actions := len(client.Actions())
+	assert.NoError(t, kv.Set("token", []byte("s3cr3t")))
+	assert.Len(t, client.Actions(), actions+1)
+	assert.Equal(t, "get", client.Actions()[actions].GetVerb())
+
+	// Cached reads do not touch the API server.
+	actions = len(client.Actions())
+	val, err := kv.Get("token")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("s3cr3t"), val)
+	assert.Len(t, client.Actions(), actions)
+}
+
+func TestSecretAdvanced(t *testing.T) {
+	client := newFakeClientset()
+
+	kv, err := NewSecretWithOptions(storeTestName, WithClientset(client), WithNamespace("secrets"))
+	assert.NoError(t, err)
+
+	set, err := kv.SetIfAbsent("lease", []byte("a"))
+	assert.NoError(t, err)
+	assert.True(t, set)
+
+	swapped, err := kv.CompareAndSwap("lease", []byte("a"), []byte("b"))
+	assert.NoError(t, err)
+	assert.True(t, swapped)
+
+	swapped, err = kv.CompareAndSwap("lease", []byte("a"), []byte("c"))
+	assert.NoError(t, err)
+	assert.False(t, swapped)
+
+	assert.NoError(t, kv.SetMany(map[string][]byte{"one": []byte("1"), "two": []byte("2")}))
+	keys, err := kv.Keys()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"lease", "one", "two"}, keys)
+
+	assert.NoError(t, kv.Truncate())
+	keys, err = kv.Keys()
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
+func TestSecretConflict(t *testing.T) {
+	client := newFakeClientset()
+
+	kv1, err := NewSecretWithOptions(storeTestName, WithClientset(client), WithNamespace(storeTestNamespace))
+	assert.NoError(t, err)
+	kv2, err := NewSecretWithOptions(storeTestName, WithClientset(client), WithNamespace(storeTestNamespace), WithCache(true))
+	assert.NoError(t, err)
+
+	// The stale cache of kv2 must not clobber the write of kv1.
+	assert.NoError(t, kv1.Set("one", []byte("1")))
+	assert.NoError(t, kv2.Set("two", []byte("2")))
+
+	keys, err := kv1.Keys()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"one", "two"}, keys)
+}
+
+func TestSecretChunks(t *testing.T) {
+	client := newFakeClientset()
+
+	kv, err := NewSecretWithOptions(storeTestName, WithClientset(client), WithNamespace(storeTestNamespace), WithChunking(4))
+	assert.NoError(t, err)
+	assert.NoError(t, kv.Set("bundle", []byte("0123456789")))
+
+	val, err := kv.Get("bundle")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("0123456789"), val)
+
+	// Chunks are kept in Secrets as well.
+	secrets, err := client.CoreV1().Secrets(storeTestNamespace).List(context.Background(), v1.ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, secrets.Items, 4)
+
+	cms, err := client.CoreV1().ConfigMaps(storeTestNamespace).List(context.Background(), v1.ListOptions{})
+	assert.NoError(t, err)
+	assert.Empty(t, cms.Items)
+}
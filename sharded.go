@@ -0,0 +1,368 @@
+package mapstore
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Verify we meet the requirements for our own interfaces.
+var _ Interface = &ShardedManager{}
+
+// ShardedManager is a thread safe key value store that spreads its keys over several ConfigMaps, named
+// `<configMapName>-<shard>`. Keys are assigned to shards using rendezvous hashing, so changing the number of shards
+// only moves the keys that have to move.
+type ShardedManager struct {
+	*sync.RWMutex
+	configMapName string
+	client        *kubeClient
+	opts          *options
+	shards        []*Manager
+}
+
+// NewSharded returns a newly setup ShardedManager using the given number of shards. The options are applied to the
+// Manager of every shard.
+func NewSharded(cmName string, shards int, opts ...Option) (*ShardedManager, error) {
+	if shards < 1 {
+		return nil, fmt.Errorf("sharded store needs at least one shard, got %d", shards)
+	}
+
+	o := newOptions(opts)
+
+	// Grab the KubeClient.
+	kubeClient, err := o.kubeClient()
+	if err != nil {
+		return nil, err
+	}
+
+	s := &ShardedManager{
+		RWMutex:       &sync.RWMutex{},
+		configMapName: cmName,
+		client:        kubeClient,
+		opts:          o,
+	}
+
+	if s.shards, err = s.newShards(nil, shards); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// newShards returns the Managers for the given number of shards, reusing the existing ones where possible.
+func (s *ShardedManager) newShards(existing []*Manager, count int) ([]*Manager, error) {
+	shards := make([]*Manager, count)
+	copy(shards, existing)
+
+	for i := len(existing); i < count; i++ {
+		shard, err := newManager(s.configMapName+"-"+strconv.Itoa(i), s.client, s.opts)
+		if err != nil {
+			return nil, err
+		}
+
+		shards[i] = shard
+	}
+
+	return shards, nil
+}
+
+// shardIndex returns the shard that owns the key, using rendezvous (highest random weight) hashing.
+func shardIndex(key string, count int) int {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	keyHash := h.Sum64()
+
+	best := 0
+	var bestScore uint64
+
+	for i := 0; i < count; i++ {
+		if score := mixHash(keyHash ^ uint64(i+1)*0x9e3779b97f4a7c15); i == 0 || score > bestScore {
+			best, bestScore = i, score
+		}
+	}
+
+	return best
+}
+
+// mixHash is the splitmix64 finalizer, which spreads small differences in the input over every bit of the output.
+func mixHash(x uint64) uint64 {
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+
+	return x ^ (x >> 31)
+}
+
+func (s *ShardedManager) shardFor(key string) *Manager {
+	return s.shards[shardIndex(key, len(s.shards))]
+}
+
+// Shards returns the current number of shards.
+func (s *ShardedManager) Shards() int {
+	s.RLock()
+	defer s.RUnlock()
+
+	return len(s.shards)
+}
+
+// Keys returns all the key names from every shard.
+func (s *ShardedManager) Keys() ([]string, error) {
+	raw, err := s.Raw()
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+// Get returns the value of the key from the shard that owns it.
+func (s *ShardedManager) Get(key string) ([]byte, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.shardFor(key).Get(key)
+}
+
+// Raw returns the combined data of every shard. Keys that are left behind in the wrong shard (by an interrupted
+// Reshard) are ignored.
+func (s *ShardedManager) Raw() (map[string][]byte, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	result := map[string][]byte{}
+	for i, shard := range s.shards {
+		raw, err := shard.Raw()
+		if err != nil {
+			return nil, err
+		}
+
+		for key, val := range raw {
+			if shardIndex(key, len(s.shards)) == i {
+				result[key] = val
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// List returns the keys and values selected by the options across every shard, sorted by key. The keys are read from
+// every shard first, and then the values on the page are read from the shards that own them.
+func (s *ShardedManager) List(opts ListOptions) (*ListResult, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	var keys []string
+	for i, shard := range s.shards {
+		shardKeys, err := shard.Keys()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range shardKeys {
+			if shardIndex(key, len(s.shards)) == i {
+				keys = append(keys, key)
+			}
+		}
+	}
+
+	keys, cont := listKeys(keys, opts)
+
+	byShard := make([][]string, len(s.shards))
+	for _, key := range keys {
+		i := shardIndex(key, len(s.shards))
+		byShard[i] = append(byShard[i], key)
+	}
+
+	values := map[string][]byte{}
+	for i, shardKeys := range byShard {
+		if len(shardKeys) == 0 {
+			continue
+		}
+
+		shardValues, err := s.shards[i].GetMany(shardKeys)
+		if err != nil {
+			return nil, err
+		}
+
+		for key, val := range shardValues {
+			values[key] = val
+		}
+	}
+
+	// Keys that were removed between the reads are left out.
+	result := &ListResult{Items: make([]KeyValue, 0, len(keys)), Continue: cont}
+	for _, key := range keys {
+		if val, ok := values[key]; ok {
+			result.Items = append(result.Items, KeyValue{key, val})
+		}
+	}
+
+	return result, nil
+}
+
+// Set writes the value to the shard that owns the key.
+func (s *ShardedManager) Set(key string, value []byte) error {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.shardFor(key).Set(key, value)
+}
+
+// SetWithTTL writes the value to the shard that owns the key, see Manager.SetWithTTL.
+func (s *ShardedManager) SetWithTTL(key string, value []byte, ttl time.Duration) error {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.shardFor(key).SetWithTTL(key, value, ttl)
+}
+
+// Delete removes the key from the shard that owns it.
+func (s *ShardedManager) Delete(key string) error {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.shardFor(key).Delete(key)
+}
+
+// Truncate removes all the data from every shard.
+func (s *ShardedManager) Truncate() error {
+	s.RLock()
+	defer s.RUnlock()
+
+	for _, shard := range s.shards {
+		if err := shard.Truncate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteExpired removes the expired keys from every shard.
+func (s *ShardedManager) DeleteExpired() error {
+	s.RLock()
+	defer s.RUnlock()
+
+	for _, shard := range s.shards {
+		if err := shard.DeleteExpired(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Rotate re-encrypts the values of every shard, see Manager.Rotate.
+func (s *ShardedManager) Rotate() error {
+	s.RLock()
+	defer s.RUnlock()
+
+	for _, shard := range s.shards {
+		if err := shard.Rotate(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reshard changes the number of shards and moves the keys that are now owned by another shard. Keys are copied to their
+// new shard before they are removed from the old one, so an interrupted Reshard loses no data and can simply be run
+// again. ConfigMaps of shards that are no longer needed are deleted.
+func (s *ShardedManager) Reshard(count int) error {
+	if count < 1 {
+		return fmt.Errorf("sharded store needs at least one shard, got %d", count)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+
+	shards, err := s.newShards(s.shards, count)
+	if err != nil {
+		return err
+	}
+
+	// Work out where every key is going, and when it expires.
+	moves := make([]map[string][]byte, count)
+	moveExpiries := make([]expiries, count)
+	leaving := make([][]string, len(s.shards))
+
+	for i, shard := range s.shards {
+		raw, err := shard.Raw()
+		if err != nil {
+			return err
+		}
+
+		exp, err := shard.storedExpiries(shard.ctx)
+		if err != nil {
+			return err
+		}
+
+		for key, val := range raw {
+			// A copy left behind by an interrupted clean up may be older than the one in the owning shard, so it is
+			// removed without being moved.
+			if shardIndex(key, len(s.shards)) != i {
+				leaving[i] = append(leaving[i], key)
+			} else if target := shardIndex(key, count); target != i {
+				if moves[target] == nil {
+					moves[target] = map[string][]byte{}
+					moveExpiries[target] = expiries{}
+				}
+
+				moves[target][key] = val
+				if at, ok := exp[shard.storedKey(key)]; ok {
+					moveExpiries[target][shard.storedKey(key)] = at
+				}
+				leaving[i] = append(leaving[i], key)
+			}
+		}
+	}
+
+	// Copy first...
+	for i, values := range moves {
+		if err := shards[i].setManyWithExpiries(shards[i].ctx, values, moveExpiries[i]); err != nil {
+			return err
+		}
+	}
+
+	// ...then switch over and clean up. Keys left behind by a failed clean up are ignored by reads.
+	previous := s.shards
+	s.shards = shards
+
+	for i, shard := range previous {
+		if i >= count {
+			// Truncating first also removes the chunks of the values left in the shard.
+			if err := shard.Truncate(); err != nil {
+				return err
+			}
+
+			shard.Close()
+			if err := shard.store.delete(shard.ctx, shard.configMapName); err != nil {
+				return err
+			}
+		} else if len(leaving[i]) > 0 {
+			if err := shard.DeleteMany(leaving[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// Close stops the informers of every shard, see NewWithInformer.
+func (s *ShardedManager) Close() {
+	s.RLock()
+	defer s.RUnlock()
+
+	for _, shard := range s.shards {
+		shard.Close()
+	}
+}
@@ -0,0 +1,166 @@
+package mapstore
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func shardedTestData(count int) map[string][]byte {
+	data := map[string][]byte{}
+	for i := 0; i < count; i++ {
+		data[fmt.Sprintf("key-%d", i)] = []byte(fmt.Sprintf("value-%d", i))
+	}
+
+	return data
+}
+
+func TestShardedSpreadsKeys(t *testing.T) {
+	client := setFakeKubeClient(t)
+
+	kv, err := NewSharded(storeTestName, 3, WithCache(true))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, kv.Shards())
+
+	data := shardedTestData(30)
+	for key, val := range data {
+		assert.NoError(t, kv.Set(key, val))
+	}
+
+	// Every shard should have some of the keys.
+	kc := &kubeClient{client, context.Background(), storeTestNamespace}
+	for i := 0; i < 3; i++ {
+		shardData, err := kc.get(kc.ctx, fmt.Sprintf("%s-%d", storeTestName, i))
+		assert.NoError(t, err)
+		assert.NotEmpty(t, shardData)
+	}
+
+	raw, err := kv.Raw()
+	assert.NoError(t, err)
+	assert.Equal(t, data, raw)
+
+	keys, err := kv.Keys()
+	assert.NoError(t, err)
+	assert.Len(t, keys, 30)
+
+	val, err := kv.Get("key-7")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("value-7"), val)
+
+	assert.NoError(t, kv.Delete("key-7"))
+	_, err = kv.Get("key-7")
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	assert.NoError(t, kv.Truncate())
+	keys, err = kv.Keys()
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
+func TestShardedReshard(t *testing.T) {
+	client := setFakeKubeClient(t)
+
+	kv, err := NewSharded(storeTestName, 2)
+	assert.NoError(t, err)
+
+	data := shardedTestData(50)
+	for key, val := range data {
+		assert.NoError(t, kv.Set(key, val))
+	}
+
+	// Grow.
+	assert.NoError(t, kv.Reshard(5))
+	assert.Equal(t, 5, kv.Shards())
+
+	raw, err := kv.Raw()
+	assert.NoError(t, err)
+	assert.Equal(t, data, raw)
+
+	// Each key should only live in the shard that owns it.
+	kc := &kubeClient{client, context.Background(), storeTestNamespace}
+	total := 0
+	for i := 0; i < 5; i++ {
+		shardData, err := kc.get(kc.ctx, fmt.Sprintf("%s-%d", storeTestName, i))
+		assert.NoError(t, err)
+		total += len(shardData)
+	}
+	assert.Equal(t, 50, total)
+
+	// Shrink.
+	assert.NoError(t, kv.Reshard(1))
+
+	keys, err := kv.Keys()
+	assert.NoError(t, err)
+	sort.Strings(keys)
+	assert.Len(t, keys, 50)
+
+	_, err = kc.getConfigMap(kc.ctx, storeTestName+"-4")
+	assert.True(t, isNotFound(err))
+}
+
+func TestShardedReshardIgnoresStaleCopies(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := NewSharded(storeTestName, 2)
+	assert.NoError(t, err)
+
+	// Find a key that moves when growing to three shards.
+	var key string
+	for key = range shardedTestData(50) {
+		if shardIndex(key, 2) != shardIndex(key, 3) {
+			break
+		}
+	}
+
+	from := shardIndex(key, 2)
+	assert.NoError(t, kv.Set(key, []byte("old")))
+	assert.NoError(t, kv.Reshard(3))
+
+	// Pretend the clean up was interrupted, and the key was written again afterwards.
+	assert.NoError(t, kv.shards[from].Set(key, []byte("old")))
+	assert.NoError(t, kv.Set(key, []byte("new")))
+
+	assert.NoError(t, kv.Reshard(3))
+
+	val, err := kv.Get(key)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("new"), val)
+
+	_, err = kv.shards[from].Get(key)
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestShardedReshardKeepsTTL(t *testing.T) {
+	setFakeKubeClient(t)
+	now := setFakeTime(t)
+
+	kv, err := NewSharded(storeTestName, 1)
+	assert.NoError(t, err)
+
+	for key, val := range shardedTestData(8) {
+		assert.NoError(t, kv.SetWithTTL(key, val, time.Minute))
+	}
+
+	assert.NoError(t, kv.Reshard(4))
+
+	*now = now.Add(2 * time.Minute)
+
+	keys, err := kv.Keys()
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+}
+
+func TestShardedIndexIsStable(t *testing.T) {
+	// Growing from 4 to 5 shards should only move keys to the new shard.
+	for key := range shardedTestData(200) {
+		before, after := shardIndex(key, 4), shardIndex(key, 5)
+		assert.True(t, before == after || after == 4)
+	}
+
+	_, err := NewSharded(storeTestName, 0)
+	assert.Error(t, err)
+}
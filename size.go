@@ -0,0 +1,69 @@
+package mapstore
+
+import (
+	"context"
+	"fmt"
+)
+
+// MaxSize is the maximum combined length of all keys and values in a ConfigMap, as validated by the API server.
+const MaxSize = 1024 * 1024
+
+// ErrSizeLimitExceeded is matched (using errors.Is) by the SizeLimitError returned when a write would exceed MaxSize.
+var ErrSizeLimitExceeded = fmt.Errorf("configmap size limit exceeded")
+
+// SizeLimitError is returned when a write would grow the ConfigMap past MaxSize. Nothing is written in that case.
+type SizeLimitError struct {
+	Current   int
+	Projected int
+}
+
+func (e *SizeLimitError) Error() string {
+	return fmt.Sprintf("%v: write would grow the configmap from %d to %d bytes (limit %d)", ErrSizeLimitExceeded, e.Current, e.Projected, MaxSize)
+}
+
+// Unwrap allows errors.Is(err, ErrSizeLimitExceeded).
+func (e *SizeLimitError) Unwrap() error {
+	return ErrSizeLimitExceeded
+}
+
+// Size returns the number of bytes used by the ConfigMap, counted the same way as MaxSize.
+func (k *Manager) Size() (int, error) {
+	return k.SizeContext(k.ctx)
+}
+
+// SizeContext is the same as Size, but uses the given context for the API calls.
+func (k *Manager) SizeContext(ctx context.Context) (int, error) {
+	k.Lock()
+	defer k.Unlock()
+
+	obj, data, err := k.load(ctx, false)
+	if err != nil {
+		return 0, err
+	}
+
+	return objectSize(obj, data), nil
+}
+
+// Remaining returns the number of bytes that can still be added to the ConfigMap.
+func (k *Manager) Remaining() (int, error) {
+	return k.RemainingContext(k.ctx)
+}
+
+// RemainingContext is the same as Remaining, but uses the given context for the API calls.
+func (k *Manager) RemainingContext(ctx context.Context) (int, error) {
+	size, err := k.SizeContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	return MaxSize - size, nil
+}
+
+// objectSize counts the data and anything else held by the object (if it exists) against MaxSize.
+func objectSize(obj object, data map[string][]byte) int {
+	if obj == nil {
+		return dataSize(data)
+	}
+
+	return obj.size(data)
+}
@@ -0,0 +1,55 @@
+package mapstore
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSizeLimitExceeded(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := New(storeTestName, true)
+	assert.NoError(t, err)
+	assert.NoError(t, kv.Set("small", []byte("value")))
+
+	size, err := kv.Size()
+	assert.NoError(t, err)
+	assert.Equal(t, 10, size)
+
+	remaining, err := kv.Remaining()
+	assert.NoError(t, err)
+	assert.Equal(t, MaxSize-10, remaining)
+
+	// One byte too many.
+	err = kv.Set("big", bytes.Repeat([]byte("x"), remaining-len("big")+1))
+	assert.True(t, errors.Is(err, ErrSizeLimitExceeded))
+
+	var sizeErr *SizeLimitError
+	assert.True(t, errors.As(err, &sizeErr))
+	assert.Equal(t, 10, sizeErr.Current)
+	assert.Equal(t, MaxSize+1, sizeErr.Projected)
+
+	// The cache is left untouched.
+	assert.Equal(t, map[string][]byte{"small": []byte("value")}, kv.internalCache)
+
+	// Filling it up exactly is fine.
+	assert.NoError(t, kv.Set("big", bytes.Repeat([]byte("x"), remaining-len("big"))))
+
+	remaining, err = kv.Remaining()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, remaining)
+}
+
+func TestSizeWithoutConfigMap(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := New(storeTestName, false)
+	assert.NoError(t, err)
+
+	size, err := kv.Size()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, size)
+}
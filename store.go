@@ -2,15 +2,34 @@ package mapstore
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"sync"
+	"time"
 
 	"k8s.io/apimachinery/pkg/api/errors"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
 )
 
-// ErrKeyNotFound is returned when looking up a value that does not exist.
-var ErrKeyNotFound = fmt.Errorf("key was not found")
+var (
+	// ErrKeyNotFound is returned when looking up a value that does not exist.
+	ErrKeyNotFound = fmt.Errorf("key was not found")
+
+	// ErrConflict is returned when a write keeps conflicting with other writers after all retries are exhausted.
+	ErrConflict = fmt.Errorf("configmap was modified concurrently, retries exhausted")
+)
+
+// conflictBackoff controls how often a write is retried after the API server reports a conflict.
+var conflictBackoff = wait.Backoff{
+	Steps:    5,
+	Duration: 10 * time.Millisecond,
+	Factor:   2.0,
+	Jitter:   0.1,
+}
+
+// mutateFunc applies a change to the given data map and reports if anything was changed.
+type mutateFunc func(data map[string][]byte) (bool, error)
 
 // Interface defines the required methods to satisfy the Manager implementation.
 type Interface interface {
@@ -21,90 +40,180 @@ type Interface interface {
 	Truncate() error
 }
 
+// ContextInterface defines the Interface methods along with Raw, but each accepts a context that is passed through to
+// the Kubernetes API calls.
+type ContextInterface interface {
+	KeysContext(ctx context.Context) ([]string, error)
+	GetContext(ctx context.Context, key string) ([]byte, error)
+	RawContext(ctx context.Context) (map[string][]byte, error)
+	SetContext(ctx context.Context, key string, value []byte) error
+	DeleteContext(ctx context.Context, key string) error
+	TruncateContext(ctx context.Context) error
+}
+
 // AdvancedInterface defines the required methods and a few optional methods for the Manager implementation.
 type AdvancedInterface interface {
 	Interface
 	Raw() (map[string][]byte, error)
 	ForceSet(key string, value []byte) error
+	CompareAndSwap(key string, old, new []byte) (bool, error)
+	SetIfAbsent(key string, value []byte) (bool, error)
+	GetMany(keys []string) (map[string][]byte, error)
+	SetMany(values map[string][]byte) error
+	DeleteMany(keys []string) error
 }
 
 // Verify we meet the requirements for our own internfaces.
 var _ Interface = &Manager{}
 var _ AdvancedInterface = &Manager{}
+var _ ContextInterface = &Manager{}
 
 // Manager is a thread safe key value store backed by a Kubernetes ConfigMap.
 type Manager struct {
 	*sync.RWMutex
+	ctx           context.Context
 	configMapName string
 	client        *kubeClient
 	cacheEnabled  bool
 	internalCache map[string][]byte
+	store         objectStore
+	object        object
+	keyEncoding   bool
+	compressor    Compressor
+	keyProvider   KeyProvider
+	dataKeys      *dataKeyCache
+	chunkSize     int
+	chunks        *chunkCache
+	chunksWritten []string
+	stopCh        chan struct{}
 }
 
 // New returns a newly setup Manager instance.
 func New(cmName string, cacheInternally bool) (*Manager, error) {
+	return NewWithOptions(cmName, WithCache(cacheInternally))
+}
+
+// NewWithOptions returns a newly setup Manager instance configured by the given options. Without any options, it
+// connects to the cluster the same way New does and does not cache the data.
+func NewWithOptions(cmName string, opts ...Option) (*Manager, error) {
+	o := newOptions(opts)
+
 	// Grab the KubeClient.
-	kubeClient, err := getKubeClient()
+	kubeClient, err := o.kubeClient()
 	if err != nil {
 		return nil, err
 	}
 
-	// If we are caching internally, fetch the data first.
-	cache := map[string][]byte{}
-	if cacheInternally {
-		if cm, err := kubeClient.getOrCreateConfigMap(cmName); err != nil {
+	return newManager(cmName, kubeClient, o)
+}
+
+func newManager(cmName string, kubeClient *kubeClient, o *options) (*Manager, error) {
+	if o.chunkSize > 0 {
+		if err := validateChunkName(cmName); err != nil {
 			return nil, err
-		} else if cm.BinaryData != nil {
-			cache = cm.BinaryData
 		}
 	}
 
-	return &Manager{
+	m := &Manager{
 		RWMutex:       &sync.RWMutex{},
+		ctx:           kubeClient.ctx,
 		configMapName: cmName,
 		client:        kubeClient,
-		cacheEnabled:  cacheInternally,
-		internalCache: cache,
-	}, nil
+		cacheEnabled:  o.cacheEnabled || o.informer,
+		internalCache: map[string][]byte{},
+		store:         o.objectStore(kubeClient),
+		keyEncoding:   o.keyEncoding,
+		compressor:    o.compressor,
+		keyProvider:   o.keyProvider,
+		dataKeys:      newDataKeyCache(),
+		chunkSize:     o.chunkSize,
+		chunks:        newChunkCache(),
+	}
+
+	if o.ctx != nil {
+		m.ctx = o.ctx
+	}
+
+	// If we are caching internally, fetch the data first.
+	if m.cacheEnabled {
+		obj, err := m.store.getOrCreate(m.ctx, cmName)
+		if err != nil {
+			return nil, err
+		}
+
+		m.setCache(obj)
+	}
+
+	if o.informer || o.janitorInterval > 0 {
+		m.stopCh = make(chan struct{})
+	}
+
+	if o.informer {
+		if err := m.startInformer(); err != nil {
+			return nil, err
+		}
+	}
+
+	if o.janitorInterval > 0 {
+		m.startJanitor(o.janitorInterval)
+	}
+
+	return m, nil
+}
+
+// setCache stores the given object as the latest known state.
+func (k *Manager) setCache(obj object) {
+	k.object = obj
+	k.internalCache = obj.getData()
+
+	if k.internalCache == nil {
+		k.internalCache = map[string][]byte{}
+	}
 }
 
-func (k *Manager) getMapData() (map[string][]byte, error) {
+func (k *Manager) getMapData(ctx context.Context) (map[string][]byte, error) {
 	if k.cacheEnabled {
-		return k.internalCache, nil
+		return k.liveData(ctx, k.internalCache), nil
 	}
 
-	data, err := k.client.get(k.configMapName)
+	obj, err := k.store.get(ctx, k.configMapName)
 
 	// Determine if the error was a "not found" error or not.
-	statusError, statusCastOk := err.(*errors.StatusError)
-	isNotFound := statusCastOk && statusError.Status().Reason == v1.StatusReasonNotFound
-	if err != nil && !isNotFound {
+	if isNotFound(err) {
+		return map[string][]byte{}, nil
+	} else if err != nil {
 		return nil, err
 	}
 
 	// If data hasn't been set yet, create an empty map.
+	data := obj.getData()
 	if data == nil {
 		data = map[string][]byte{}
 	}
 
-	return data, nil
+	return k.liveData(ctx, data), nil
 }
 
 // Keys returns all the key names from the ConfigMap.
 func (k *Manager) Keys() ([]string, error) {
+	return k.KeysContext(k.ctx)
+}
+
+// KeysContext is the same as Keys, but uses the given context for the API calls.
+func (k *Manager) KeysContext(ctx context.Context) ([]string, error) {
 	k.RLock()
 	defer k.RUnlock()
 
 	// Grab the data map.
-	dataMap, err := k.getMapData()
+	dataMap, err := k.getMapData(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	// Lookup all the keys.
 	keys := make([]string, 0, len(dataMap))
-	for k := range dataMap {
-		keys = append(keys, k)
+	for key := range dataMap {
+		keys = append(keys, k.userKey(key))
 	}
 
 	return keys, nil
@@ -112,103 +221,470 @@ func (k *Manager) Keys() ([]string, error) {
 
 // Get uses the supplied key and attempts to return the coorsponding value from the ConfigMap.
 func (k *Manager) Get(key string) ([]byte, error) {
+	return k.GetContext(k.ctx, key)
+}
+
+// GetContext is the same as Get, but uses the given context for the API calls.
+func (k *Manager) GetContext(ctx context.Context, key string) ([]byte, error) {
 	k.RLock()
 	defer k.RUnlock()
 
 	// Grab the data map.
-	dataMap, err := k.getMapData()
+	dataMap, err := k.getMapData(ctx)
 	if err != nil {
 		return nil, err
 	}
 
 	// Lookup the value, return not found if it failed.
-	val, ok := dataMap[key]
+	stored := k.storedKey(key)
+	val, ok := dataMap[stored]
 	if !ok {
 		return nil, ErrKeyNotFound
 	}
 
-	return val, nil
+	return k.decodeValue(ctx, stored, val)
+}
+
+// GetMany looks up all the given keys with a single read. Keys that do not exist are left out of the result.
+func (k *Manager) GetMany(keys []string) (map[string][]byte, error) {
+	return k.GetManyContext(k.ctx, keys)
 }
 
-// Raw returns the actual underlying map data.
+// GetManyContext is the same as GetMany, but uses the given context for the API calls.
+func (k *Manager) GetManyContext(ctx context.Context, keys []string) (map[string][]byte, error) {
+	k.RLock()
+	defer k.RUnlock()
+
+	// Grab the data map.
+	dataMap, err := k.getMapData(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		if val, ok := dataMap[k.storedKey(key)]; ok {
+			result[k.storedKey(key)] = val
+		}
+	}
+
+	if result, err = k.decodeData(ctx, result, false); err != nil {
+		return nil, err
+	}
+
+	return k.userData(result), nil
+}
+
+// Raw returns a copy of the underlying map data, with any compression removed from the values.
 func (k *Manager) Raw() (map[string][]byte, error) {
+	return k.RawContext(k.ctx)
+}
+
+// RawContext is the same as Raw, but uses the given context for the API calls.
+func (k *Manager) RawContext(ctx context.Context) (map[string][]byte, error) {
 	k.RLock()
 	defer k.RUnlock()
 
 	// Grab the data map.
-	dataMap, err := k.getMapData()
+	dataMap, err := k.getMapData(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	return dataMap, nil
+	if dataMap, err = k.decodeData(ctx, dataMap, false); err != nil {
+		return nil, err
+	}
+
+	return k.userData(dataMap), nil
 }
 
 // Set checks if the value has changed before performing the underlying save call.
 func (k *Manager) Set(key string, value []byte) error {
+	return k.SetContext(k.ctx, key, value)
+}
+
+// SetContext is the same as Set, but uses the given context for the API calls.
+func (k *Manager) SetContext(ctx context.Context, key string, value []byte) error {
 	k.Lock()
 	defer k.Unlock()
 
-	return k.set(key, value, false)
+	return k.set(ctx, key, value, false)
 }
 
 // ForceSet is the same as Set, but does not check if the values are equal first.
 func (k *Manager) ForceSet(key string, value []byte) error {
+	return k.ForceSetContext(k.ctx, key, value)
+}
+
+// ForceSetContext is the same as ForceSet, but uses the given context for the API calls.
+func (k *Manager) ForceSetContext(ctx context.Context, key string, value []byte) error {
 	k.Lock()
 	defer k.Unlock()
 
-	return k.set(key, value, true)
+	return k.set(ctx, key, value, true)
 }
 
-func (k *Manager) set(key string, value []byte, force bool) error {
-	// Grab the data map.
-	dataMap, err := k.getMapData()
+// SetMany sets all the given values with a single write. Like Set, nothing is written if every value is unchanged.
+func (k *Manager) SetMany(values map[string][]byte) error {
+	return k.SetManyContext(k.ctx, values)
+}
+
+// SetManyContext is the same as SetMany, but uses the given context for the API calls.
+func (k *Manager) SetManyContext(ctx context.Context, values map[string][]byte) error {
+	stored := make(map[string][]byte, len(values))
+	for key, value := range values {
+		storedKey, err := k.checkKey(key)
+		if err != nil {
+			return err
+		}
+
+		stored[storedKey] = value
+	}
+
+	k.Lock()
+	defer k.Unlock()
+
+	return k.mutate(ctx, false, func(data map[string][]byte) (bool, error) {
+		changed := false
+		for key, value := range stored {
+			if ogValue, ok := data[key]; ok && bytes.Equal(ogValue, value) {
+				continue
+			}
+
+			data[key] = value
+			changed = true
+		}
+
+		return changed, nil
+	})
+}
+
+// CompareAndSwap sets the key to new only if it currently holds old, and reports whether the value was swapped.
+// The comparison is made against the latest ConfigMap on the API server and the write fails if it changes in between.
+func (k *Manager) CompareAndSwap(key string, old, new []byte) (bool, error) {
+	return k.CompareAndSwapContext(k.ctx, key, old, new)
+}
+
+// CompareAndSwapContext is the same as CompareAndSwap, but uses the given context for the API calls.
+func (k *Manager) CompareAndSwapContext(ctx context.Context, key string, old, new []byte) (bool, error) {
+	key, err := k.checkKey(key)
 	if err != nil {
-		return err
+		return false, err
 	}
 
-	if !force {
-		// Look up the original value and check if it's the same.
-		if ogValue, ok := dataMap[key]; ok && bytes.Equal(ogValue, value) {
-			return nil
+	k.Lock()
+	defer k.Unlock()
+
+	swapped := false
+	err = k.mutate(ctx, true, func(data map[string][]byte) (bool, error) {
+		ogValue, ok := data[key]
+		swapped = ok && bytes.Equal(ogValue, old)
+
+		// Nothing to write if the comparison failed or the value stays the same.
+		if !swapped || bytes.Equal(old, new) {
+			return false, nil
 		}
+
+		data[key] = new
+
+		return true, nil
+	})
+
+	return swapped && err == nil, err
+}
+
+// SetIfAbsent sets the key only if it does not exist yet, and reports whether the value was set.
+func (k *Manager) SetIfAbsent(key string, value []byte) (bool, error) {
+	return k.SetIfAbsentContext(k.ctx, key, value)
+}
+
+// SetIfAbsentContext is the same as SetIfAbsent, but uses the given context for the API calls.
+func (k *Manager) SetIfAbsentContext(ctx context.Context, key string, value []byte) (bool, error) {
+	key, err := k.checkKey(key)
+	if err != nil {
+		return false, err
 	}
 
-	// Set the new value.
-	dataMap[key] = value
+	k.Lock()
+	defer k.Unlock()
+
+	set := false
+	err = k.mutate(ctx, true, func(data map[string][]byte) (bool, error) {
+		_, exists := data[key]
+		if !exists {
+			data[key] = value
+		}
+
+		set = !exists
+
+		return set, nil
+	})
 
-	// Write the ConfigMap.
-	return k.client.set(k.configMapName, dataMap)
+	return set && err == nil, err
 }
 
-// Delete removes the given key from the underlying ConfigMap.
-func (k *Manager) Delete(key string) error {
+// Update calls fn with a copy of the current value of the key and writes back the value it returns. If the ConfigMap is
+// changed by another writer before the write lands, fn is called again with the fresh value. Returning an error from fn
+// aborts the update and the error is passed through.
+func (k *Manager) Update(key string, fn func(old []byte, exists bool) ([]byte, error)) error {
+	return k.UpdateContext(k.ctx, key, fn)
+}
+
+// UpdateContext is the same as Update, but uses the given context for the API calls.
+func (k *Manager) UpdateContext(ctx context.Context, key string, fn func(old []byte, exists bool) ([]byte, error)) error {
+	key, err := k.checkKey(key)
+	if err != nil {
+		return err
+	}
+
 	k.Lock()
 	defer k.Unlock()
 
-	// Grab the data map.
-	dataMap, err := k.getMapData()
+	return k.mutate(ctx, true, func(data map[string][]byte) (bool, error) {
+		ogValue, exists := data[key]
+
+		// fn gets a copy, so changing the old value in place can't touch the stored data.
+		var old []byte
+		if exists {
+			old = append([]byte{}, ogValue...)
+		}
+
+		value, err := fn(old, exists)
+		if err != nil {
+			return false, err
+		}
+
+		if exists && bytes.Equal(ogValue, value) {
+			return false, nil
+		}
+
+		data[key] = value
+
+		return true, nil
+	})
+}
+
+func (k *Manager) set(ctx context.Context, key string, value []byte, force bool) error {
+	key, err := k.checkKey(key)
 	if err != nil {
 		return err
 	}
 
-	// Delete the key/value.
-	delete(dataMap, key)
+	return k.mutate(ctx, false, func(data map[string][]byte) (bool, error) {
+		if !force {
+			// Look up the original value and check if it's the same.
+			if ogValue, ok := data[key]; ok && bytes.Equal(ogValue, value) {
+				return false, nil
+			}
+		}
+
+		// Set the new value.
+		data[key] = value
+
+		return true, nil
+	})
+}
+
+// Delete removes the given key from the underlying ConfigMap.
+func (k *Manager) Delete(key string) error {
+	return k.DeleteContext(k.ctx, key)
+}
+
+// DeleteContext is the same as Delete, but uses the given context for the API calls.
+func (k *Manager) DeleteContext(ctx context.Context, key string) error {
+	k.Lock()
+	defer k.Unlock()
+
+	key = k.storedKey(key)
+
+	return k.mutate(ctx, false, func(data map[string][]byte) (bool, error) {
+		// Delete the key/value.
+		delete(data, key)
+
+		return true, nil
+	})
+}
+
+// DeleteMany removes all the given keys from the underlying ConfigMap with a single write.
+func (k *Manager) DeleteMany(keys []string) error {
+	return k.DeleteManyContext(k.ctx, keys)
+}
+
+// DeleteManyContext is the same as DeleteMany, but uses the given context for the API calls.
+func (k *Manager) DeleteManyContext(ctx context.Context, keys []string) error {
+	k.Lock()
+	defer k.Unlock()
+
+	return k.mutate(ctx, false, func(data map[string][]byte) (bool, error) {
+		for _, key := range keys {
+			delete(data, k.storedKey(key))
+		}
 
-	// Write the ConfigMap.
-	return k.client.set(k.configMapName, dataMap)
+		return true, nil
+	})
 }
 
 // Truncate removes all the data from the underlying ConfigMap.
 func (k *Manager) Truncate() error {
+	return k.TruncateContext(k.ctx)
+}
+
+// TruncateContext is the same as Truncate, but uses the given context for the API calls.
+func (k *Manager) TruncateContext(ctx context.Context) error {
 	k.Lock()
 	defer k.Unlock()
 
-	// Reset the internal cache if needed.
+	return k.mutate(ctx, false, func(data map[string][]byte) (bool, error) {
+		for key := range data {
+			delete(data, key)
+		}
+
+		return true, nil
+	})
+}
+
+// mutate applies fn to a copy of the ConfigMap data and writes the result back using the ResourceVersion it was read
+// at. If another writer changed the ConfigMap in the meantime, the data is read again and fn is re-applied until the
+// write succeeds or conflictBackoff is exhausted. The internal cache is used for the first attempt unless refresh is
+// set, but if fn makes no change to the cached data, it is applied again to the data on the server before giving up.
+// The caller must hold the write lock.
+func (k *Manager) mutate(ctx context.Context, refresh bool, fn mutateFunc) error {
+	return k.rewrite(ctx, refresh, false, nil, fn)
+}
+
+// rewrite is the same as mutate, but encodes every value again if reencode is set, instead of only the values fn
+// changed. Values that fail to decode are an error then, as they could not be encoded again. The keys in expiresAt
+// expire at the given times if fn sets them.
+func (k *Manager) rewrite(ctx context.Context, refresh, reencode bool, expiresAt expiries, fn mutateFunc) error {
+	// Track the data before and after the write, so chunks that are no longer needed can be removed.
+	var before, after map[string][]byte
+	committed := false
+
+	err := wait.ExponentialBackoffWithContext(ctx, conflictBackoff, func() (bool, error) {
+		for {
+			cached := k.cacheEnabled && !refresh
+			obj, stored, err := k.load(ctx, refresh)
+			if err != nil {
+				return false, err
+			}
+
+			before, after = stored, stored
+
+			// Any retry has to start from the current state on the server.
+			refresh = true
+
+			// Let fn work on the decoded values, then encode whatever it changed.
+			data, err := k.decodeData(ctx, stored, !reencode)
+			if err != nil {
+				return false, err
+			}
+
+			original := copyData(data)
+
+			// Let fn only see the keys that have not expired. Expired keys are dropped by the write.
+			exp := takeExpiries(data, timeNow())
+			visible := copyData(data)
+			if changed, err := fn(data); err != nil {
+				return true, err
+			} else if !changed {
+				// The cache may be behind another writer, so only trust a no-op decided against the server.
+				if cached {
+					continue
+				}
+
+				return true, nil
+			}
+
+			if err := putExpiries(exp, visible, data, expiresAt); err != nil {
+				return false, err
+			}
+
+			if reencode {
+				original = nil
+			}
+
+			if data, err = k.encodeData(ctx, stored, original, data); err != nil {
+				return false, err
+			}
+
+			// Don't bother sending a write the API server is going to reject.
+			if projected := objectSize(obj, data); projected > MaxSize {
+				return false, &SizeLimitError{Current: objectSize(obj, stored), Projected: projected}
+			}
+
+			// Write the object, creating it if it does not exist yet.
+			var saved object
+			if obj == nil {
+				saved, err = k.store.create(ctx, k.configMapName, data)
+			} else {
+				saved, err = k.store.update(ctx, obj.withData(data))
+			}
+
+			if isConflict(err) {
+				return false, nil
+			} else if err != nil {
+				return false, err
+			}
+
+			if k.cacheEnabled {
+				k.setCache(saved)
+			}
+
+			after = data
+			committed = true
+
+			return true, nil
+		}
+	})
+
+	if len(k.chunksWritten) > 0 || len(chunkNames(before)) > 0 {
+		k.cleanupChunks(ctx, committed && err == nil, before, after)
+	}
+
+	if err == wait.ErrWaitTimeout {
+		return ErrConflict
+	}
+
+	return err
+}
+
+// load returns the object along with its stored data, neither of which must be modified. The returned object is nil
+// if it does not exist yet. The internal cache is used unless it is disabled or refresh is set.
+func (k *Manager) load(ctx context.Context, refresh bool) (object, map[string][]byte, error) {
+	if k.cacheEnabled && !refresh && k.object != nil {
+		return k.object, k.internalCache, nil
+	}
+
+	obj, err := k.store.get(ctx, k.configMapName)
+	if isNotFound(err) {
+		return nil, map[string][]byte{}, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	// Keep the internal cache in step with what we just read.
 	if k.cacheEnabled {
-		k.internalCache = map[string][]byte{}
+		k.setCache(obj)
+	}
+
+	return obj, obj.getData(), nil
+}
+
+func copyData(data map[string][]byte) map[string][]byte {
+	result := make(map[string][]byte, len(data))
+	for key, val := range data {
+		result[key] = val
 	}
 
-	// Write the ConfigMap with a new blank map.
-	return k.client.set(k.configMapName, map[string][]byte{})
+	return result
+}
+
+func isNotFound(err error) bool {
+	statusError, ok := err.(*errors.StatusError)
+	return ok && statusError.Status().Reason == v1.StatusReasonNotFound
+}
+
+// isConflict reports if a write was rejected because the ConfigMap was changed (or created) by someone else.
+func isConflict(err error) bool {
+	return errors.IsConflict(err) || errors.IsAlreadyExists(err)
 }
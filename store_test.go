@@ -2,11 +2,18 @@ package mapstore
 
 import (
 	"context"
+	"fmt"
 	"sort"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 const (
@@ -14,9 +21,12 @@ const (
 	storeTestNamespace = "ns-foobar"
 )
 
-func setFakeKubeClient(t *testing.T) {
-	singleton = &kubeClient{fake.NewSimpleClientset(), context.Background(), storeTestNamespace}
+func setFakeKubeClient(t *testing.T) *fake.Clientset {
+	client := newFakeClientset()
+	singleton = &kubeClient{client, context.Background(), storeTestNamespace}
 	t.Cleanup(func() { singleton = nil })
+
+	return client
 }
 
 func TestStoreNew(t *testing.T) {
@@ -58,7 +68,7 @@ func TestStoreGetMapData(t *testing.T) {
 	assert.NotNil(t, kv)
 
 	// Should return nothing.
-	data, err := kv.getMapData()
+	data, err := kv.getMapData(kv.ctx)
 	assert.NoError(t, err)
 	assert.Empty(t, data)
 
@@ -67,7 +77,7 @@ func TestStoreGetMapData(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Should return data now.
-	data, err = kv.getMapData()
+	data, err = kv.getMapData(kv.ctx)
 	assert.NoError(t, err)
 	assert.Equal(t, []byte("bar"), data["foo"])
 }
@@ -81,7 +91,7 @@ func TestStoreGetMapDataWithInternalCache(t *testing.T) {
 	kv.internalCache = map[string][]byte{"foo": []byte("bar")}
 
 	// Should return data now.
-	data, err := kv.getMapData()
+	data, err := kv.getMapData(kv.ctx)
 	assert.NoError(t, err)
 	assert.Equal(t, []byte("bar"), data["foo"])
 }
@@ -285,3 +295,310 @@ func TestStoreTruncate(t *testing.T) {
 	assert.Error(t, err)
 	assert.Equal(t, ErrKeyNotFound, err)
 }
+
+func TestStoreSetWithConcurrentWriter(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv1, err := New(storeTestName, true)
+	assert.NoError(t, err)
+	kv2, err := New(storeTestName, true)
+	assert.NoError(t, err)
+
+	// The second manager has a stale cache after the first one writes.
+	assert.NoError(t, kv1.Set("k1", []byte("v1")))
+	assert.NoError(t, kv2.Set("k2", []byte("v2")))
+
+	// Neither write should have been lost.
+	data, err := kv2.client.get(kv2.ctx, storeTestName)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"k1": []byte("v1"), "k2": []byte("v2")}, data)
+	assert.Equal(t, data, kv2.internalCache)
+}
+
+func TestStoreDeleteWithConcurrentWriter(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv1, err := New(storeTestName, false)
+	assert.NoError(t, err)
+	kv2, err := New(storeTestName, true)
+	assert.NoError(t, err)
+
+	assert.NoError(t, kv1.Set("k1", []byte("v1")))
+	assert.NoError(t, kv1.Set("k2", []byte("v2")))
+	assert.NoError(t, kv2.Delete("k1"))
+
+	keys, err := kv1.Keys()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"k2"}, keys)
+}
+
+func TestStoreSetSameValueWithStaleCache(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv1, err := New(storeTestName, true)
+	assert.NoError(t, err)
+	kv2, err := New(storeTestName, true)
+	assert.NoError(t, err)
+
+	assert.NoError(t, kv1.Set("k", []byte("1")))
+	assert.NoError(t, kv2.Set("k", []byte("2")))
+
+	// The cache of the first manager still holds "1", but the write must not be skipped.
+	assert.NoError(t, kv1.Set("k", []byte("1")))
+
+	data, err := kv2.client.get(kv2.ctx, storeTestName)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"k": []byte("1")}, data)
+}
+
+func TestStoreSetConflictExhausted(t *testing.T) {
+	client := setFakeKubeClient(t)
+
+	kv, err := New(storeTestName, true)
+	assert.NoError(t, err)
+
+	// Reject every update.
+	updates := 0
+	client.PrependReactor("update", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		updates++
+		return true, nil, errors.NewConflict(schema.GroupResource{Resource: "configmaps"}, storeTestName, nil)
+	})
+
+	err = kv.Set("hello", []byte("world"))
+	assert.Equal(t, ErrConflict, err)
+	assert.Equal(t, conflictBackoff.Steps, updates)
+	assert.Empty(t, kv.internalCache)
+}
+
+func TestStoreCompareAndSwap(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := New(storeTestName, true)
+	assert.NoError(t, err)
+	assert.NoError(t, kv.Set("hello", []byte("world")))
+
+	// Mismatched old value.
+	swapped, err := kv.CompareAndSwap("hello", []byte("nope"), []byte("there"))
+	assert.NoError(t, err)
+	assert.False(t, swapped)
+
+	// Missing key.
+	swapped, err = kv.CompareAndSwap("missing", nil, []byte("there"))
+	assert.NoError(t, err)
+	assert.False(t, swapped)
+
+	// Matching old value.
+	swapped, err = kv.CompareAndSwap("hello", []byte("world"), []byte("there"))
+	assert.NoError(t, err)
+	assert.True(t, swapped)
+
+	data, err := kv.Get("hello")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("there"), data)
+}
+
+func TestStoreCompareAndSwapWithStaleCache(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv1, err := New(storeTestName, false)
+	assert.NoError(t, err)
+	kv2, err := New(storeTestName, true)
+	assert.NoError(t, err)
+
+	// The cached manager has not seen this value yet, but the swap must still succeed.
+	assert.NoError(t, kv1.Set("hello", []byte("world")))
+
+	swapped, err := kv2.CompareAndSwap("hello", []byte("world"), []byte("there"))
+	assert.NoError(t, err)
+	assert.True(t, swapped)
+
+	// The other manager is the one that is stale now.
+	swapped, err = kv1.CompareAndSwap("hello", []byte("world"), []byte("again"))
+	assert.NoError(t, err)
+	assert.False(t, swapped)
+}
+
+func TestStoreSetIfAbsent(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := New(storeTestName, false)
+	assert.NoError(t, err)
+
+	set, err := kv.SetIfAbsent("hello", []byte("world"))
+	assert.NoError(t, err)
+	assert.True(t, set)
+
+	set, err = kv.SetIfAbsent("hello", []byte("there"))
+	assert.NoError(t, err)
+	assert.False(t, set)
+
+	data, err := kv.Get("hello")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("world"), data)
+}
+
+func TestStoreUpdate(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := New(storeTestName, true)
+	assert.NoError(t, err)
+
+	increment := func(old []byte, exists bool) ([]byte, error) {
+		num := 0
+		if exists {
+			num, _ = strconv.Atoi(string(old))
+		}
+
+		return []byte(strconv.Itoa(num + 1)), nil
+	}
+
+	assert.NoError(t, kv.Update("counter", increment))
+	assert.NoError(t, kv.Update("counter", increment))
+
+	data, err := kv.Get("counter")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("2"), data)
+}
+
+func TestStoreUpdateInPlace(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := New(storeTestName, true)
+	assert.NoError(t, err)
+	assert.NoError(t, kv.Set("counter", []byte{1}))
+
+	// Changing the old value in place must still be written.
+	assert.NoError(t, kv.Update("counter", func(old []byte, exists bool) ([]byte, error) {
+		old[0]++
+		return old, nil
+	}))
+
+	val, err := kv.Get("counter")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{2}, val)
+
+	data, err := kv.client.get(kv.ctx, storeTestName)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"counter": {2}}, data)
+}
+
+func TestStoreUpdateWithConcurrentWriter(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv1, err := New(storeTestName, false)
+	assert.NoError(t, err)
+	kv2, err := New(storeTestName, true)
+	assert.NoError(t, err)
+
+	assert.NoError(t, kv1.Set("counter", []byte("a")))
+
+	// Sneak in another write during the first call to fn, which forces a retry.
+	calls := 0
+	err = kv2.Update("counter", func(old []byte, exists bool) ([]byte, error) {
+		calls++
+		if calls == 1 {
+			assert.NoError(t, kv1.Set("counter", []byte("ab")))
+		}
+
+		return append(append([]byte{}, old...), 'c'), nil
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, calls)
+
+	data, err := kv1.Get("counter")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("abc"), data)
+}
+
+func TestStoreUpdateError(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := New(storeTestName, true)
+	assert.NoError(t, err)
+
+	fnErr := fmt.Errorf("nope")
+	err = kv.Update("hello", func(old []byte, exists bool) ([]byte, error) {
+		assert.False(t, exists)
+		return nil, fnErr
+	})
+	assert.Equal(t, fnErr, err)
+
+	_, err = kv.Get("hello")
+	assert.Equal(t, ErrKeyNotFound, err)
+}
+
+func TestStoreGetMany(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := New(storeTestName, false)
+	assert.NoError(t, err)
+	assert.NoError(t, kv.Set("k1", []byte("v1")))
+	assert.NoError(t, kv.Set("k2", []byte("v2")))
+
+	data, err := kv.GetMany([]string{"k1", "k2", "k3"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"k1": []byte("v1"), "k2": []byte("v2")}, data)
+}
+
+func TestStoreSetMany(t *testing.T) {
+	client := setFakeKubeClient(t)
+
+	kv, err := New(storeTestName, true)
+	assert.NoError(t, err)
+	assert.NoError(t, kv.Set("k1", []byte("v1")))
+
+	updates := 0
+	client.PrependReactor("update", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		updates++
+		return false, nil, nil
+	})
+
+	values := map[string][]byte{"k1": []byte("v1"), "k2": []byte("v2"), "k3": []byte("v3")}
+	assert.NoError(t, kv.SetMany(values))
+	assert.Equal(t, 1, updates)
+	assert.Equal(t, values, kv.internalCache)
+
+	// Setting the same values again is a no-op.
+	assert.NoError(t, kv.SetMany(values))
+	assert.Equal(t, 1, updates)
+}
+
+func TestStoreDeleteMany(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := New(storeTestName, true)
+	assert.NoError(t, err)
+	assert.NoError(t, kv.SetMany(map[string][]byte{"k1": []byte("v1"), "k2": []byte("v2"), "k3": []byte("v3")}))
+
+	assert.NoError(t, kv.DeleteMany([]string{"k1", "k3", "k4"}))
+
+	keys, err := kv.Keys()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"k2"}, keys)
+}
+
+func TestStoreSetContextCanceled(t *testing.T) {
+	client := setFakeKubeClient(t)
+
+	kv, err := New(storeTestName, true)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Nothing is sent to the API server with a canceled context.
+	err = kv.SetContext(ctx, "hello", []byte("world"))
+	assert.Equal(t, context.Canceled, err)
+	assert.Empty(t, kv.internalCache)
+
+	// Stop retrying conflicts once the deadline passes.
+	client.PrependReactor("update", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewConflict(schema.GroupResource{Resource: "configmaps"}, storeTestName, nil)
+	})
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Millisecond)
+	t.Cleanup(cancel)
+
+	err = kv.SetContext(ctx, "hello", []byte("world"))
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
@@ -0,0 +1,165 @@
+package mapstore
+
+import (
+	"bytes"
+	"context"
+)
+
+// Cmp is a condition on a single key that is checked when a Txn is committed.
+type Cmp struct {
+	key   string
+	check func(value []byte, exists bool) bool
+}
+
+// Exists returns a condition that holds when the key is present.
+func Exists(key string) Cmp {
+	return Cmp{key, func(_ []byte, exists bool) bool { return exists }}
+}
+
+// Missing returns a condition that holds when the key is not present.
+func Missing(key string) Cmp {
+	return Cmp{key, func(_ []byte, exists bool) bool { return !exists }}
+}
+
+// Equal returns a condition that holds when the key is present and holds the given value.
+func Equal(key string, value []byte) Cmp {
+	return Cmp{key, func(v []byte, exists bool) bool { return exists && bytes.Equal(v, value) }}
+}
+
+// NotEqual returns a condition that holds when the key is missing or holds a different value.
+func NotEqual(key string, value []byte) Cmp {
+	return Cmp{key, func(v []byte, exists bool) bool { return !exists || !bytes.Equal(v, value) }}
+}
+
+// Op is a single write that is applied when a Txn is committed.
+type Op struct {
+	key    string
+	value  []byte
+	delete bool
+}
+
+// OpSet returns an operation that sets the key to the given value.
+func OpSet(key string, value []byte) Op {
+	return Op{key: key, value: value}
+}
+
+// OpDelete returns an operation that removes the key.
+func OpDelete(key string) Op {
+	return Op{key: key, delete: true}
+}
+
+// Txn groups conditional writes that are committed to the ConfigMap in a single update. It is built with If, Then and
+// Else and sent with Commit.
+type Txn struct {
+	manager *Manager
+	cmps    []Cmp
+	thenOps []Op
+	elseOps []Op
+}
+
+// Txn starts a new transaction against the ConfigMap.
+func (k *Manager) Txn() *Txn {
+	return &Txn{manager: k}
+}
+
+// If adds conditions that must all hold for the Then operations to be applied.
+func (t *Txn) If(cmps ...Cmp) *Txn {
+	t.cmps = append(t.cmps, cmps...)
+	return t
+}
+
+// Then adds operations that are applied when all conditions hold.
+func (t *Txn) Then(ops ...Op) *Txn {
+	t.thenOps = append(t.thenOps, ops...)
+	return t
+}
+
+// Else adds operations that are applied when any condition does not hold.
+func (t *Txn) Else(ops ...Op) *Txn {
+	t.elseOps = append(t.elseOps, ops...)
+	return t
+}
+
+// Commit evaluates the conditions against the latest ConfigMap and writes either the Then or the Else operations in a
+// single update. It reports whether the conditions held. If the ConfigMap changes before the write lands, the
+// conditions are evaluated again.
+func (t *Txn) Commit() (bool, error) {
+	return t.CommitContext(t.manager.ctx)
+}
+
+// CommitContext is the same as Commit, but uses the given context for the API calls.
+func (t *Txn) CommitContext(ctx context.Context) (bool, error) {
+	thenOps, err := t.manager.storedOps(t.thenOps)
+	if err != nil {
+		return false, err
+	}
+
+	elseOps, err := t.manager.storedOps(t.elseOps)
+	if err != nil {
+		return false, err
+	}
+
+	t.manager.Lock()
+	defer t.manager.Unlock()
+
+	succeeded := false
+	err = t.manager.mutate(ctx, true, func(data map[string][]byte) (bool, error) {
+		succeeded = true
+		for _, cmp := range t.cmps {
+			value, exists := data[t.manager.storedKey(cmp.key)]
+			if !cmp.check(value, exists) {
+				succeeded = false
+				break
+			}
+		}
+
+		ops := thenOps
+		if !succeeded {
+			ops = elseOps
+		}
+
+		return applyOps(data, ops), nil
+	})
+
+	return succeeded, err
+}
+
+// storedOps returns the operations with the keys as they are stored, or an error if a value would be set on an
+// invalid key.
+func (k *Manager) storedOps(ops []Op) ([]Op, error) {
+	result := make([]Op, len(ops))
+	for i, op := range ops {
+		result[i] = op
+		if op.delete {
+			result[i].key = k.storedKey(op.key)
+			continue
+		}
+
+		key, err := k.checkKey(op.key)
+		if err != nil {
+			return nil, err
+		}
+
+		result[i].key = key
+	}
+
+	return result, nil
+}
+
+// applyOps applies the operations in order and reports if the data was changed.
+func applyOps(data map[string][]byte, ops []Op) bool {
+	changed := false
+	for _, op := range ops {
+		ogValue, exists := data[op.key]
+
+		if op.delete {
+			delete(data, op.key)
+			changed = changed || exists
+		} else if !exists || !bytes.Equal(ogValue, op.value) {
+			data[op.key] = op.value
+			changed = true
+		}
+	}
+
+	return changed
+}
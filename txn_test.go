@@ -0,0 +1,79 @@
+package mapstore
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestTxnThen(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := New(storeTestName, true)
+	assert.NoError(t, err)
+	assert.NoError(t, kv.Set("owner", []byte("none")))
+	assert.NoError(t, kv.Set("stale", []byte("yes")))
+
+	succeeded, err := kv.Txn().
+		If(Equal("owner", []byte("none")), Missing("lock"), Exists("stale")).
+		Then(OpSet("owner", []byte("me")), OpSet("lock", []byte("1")), OpDelete("stale")).
+		Else(OpSet("failed", []byte("1"))).
+		Commit()
+	assert.NoError(t, err)
+	assert.True(t, succeeded)
+
+	raw, err := kv.Raw()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"owner": []byte("me"), "lock": []byte("1")}, raw)
+}
+
+func TestTxnElse(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := New(storeTestName, false)
+	assert.NoError(t, err)
+	assert.NoError(t, kv.Set("owner", []byte("someone")))
+
+	succeeded, err := kv.Txn().
+		If(NotEqual("owner", []byte("someone"))).
+		Then(OpSet("owner", []byte("me"))).
+		Else(OpSet("failed", []byte("1"))).
+		Commit()
+	assert.NoError(t, err)
+	assert.False(t, succeeded)
+
+	raw, err := kv.Raw()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"owner": []byte("someone"), "failed": []byte("1")}, raw)
+}
+
+func TestTxnSingleUpdate(t *testing.T) {
+	client := setFakeKubeClient(t)
+
+	kv, err := New(storeTestName, true)
+	assert.NoError(t, err)
+
+	updates := 0
+	client.PrependReactor("update", "configmaps", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		updates++
+		return false, nil, nil
+	})
+
+	_, err = kv.Txn().Then(
+		OpSet("k1", []byte("v1")),
+		OpSet("k2", []byte("v2")),
+		OpSet("k3", []byte("v3")),
+		OpSet("k4", []byte("v4")),
+		OpSet("k5", []byte("v5")),
+	).Commit()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, updates)
+	assert.Len(t, kv.internalCache, 5)
+
+	// Nothing changed, so nothing is written.
+	_, err = kv.Txn().Then(OpSet("k1", []byte("v1")), OpDelete("missing")).Commit()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, updates)
+}
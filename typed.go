@@ -0,0 +1,163 @@
+package mapstore
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	"sigs.k8s.io/yaml"
+)
+
+// Codec turns values of type T into the bytes that are stored and back.
+type Codec[T any] interface {
+	Marshal(value T) ([]byte, error)
+	Unmarshal(data []byte) (T, error)
+}
+
+// DecodeError is returned by a TypedStore when a stored value can not be decoded by its Codec.
+type DecodeError struct {
+	Key string
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("decoding value of key %q: %v", e.Key, e.Err)
+}
+
+// Unwrap returns the error of the Codec.
+func (e *DecodeError) Unwrap() error {
+	return e.Err
+}
+
+// TypedStore stores values of type T in any Interface (such as a Manager), using a Codec to turn them into bytes.
+type TypedStore[T any] struct {
+	store Interface
+	codec Codec[T]
+}
+
+// NewTypedStore returns a TypedStore that keeps its values in the given store.
+func NewTypedStore[T any](store Interface, codec Codec[T]) *TypedStore[T] {
+	return &TypedStore[T]{store, codec}
+}
+
+// Keys returns all the key names from the underlying store.
+func (t *TypedStore[T]) Keys() ([]string, error) {
+	return t.store.Keys()
+}
+
+// Get returns the decoded value of the key. A value that can't be decoded returns a *DecodeError.
+func (t *TypedStore[T]) Get(key string) (T, error) {
+	var value T
+
+	data, err := t.store.Get(key)
+	if err != nil {
+		return value, err
+	}
+
+	if value, err = t.codec.Unmarshal(data); err != nil {
+		return value, &DecodeError{Key: key, Err: err}
+	}
+
+	return value, nil
+}
+
+// Set encodes the value and stores it under the key.
+func (t *TypedStore[T]) Set(key string, value T) error {
+	data, err := t.codec.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("encoding value of key %q: %w", key, err)
+	}
+
+	return t.store.Set(key, data)
+}
+
+// Delete removes the key from the underlying store.
+func (t *TypedStore[T]) Delete(key string) error {
+	return t.store.Delete(key)
+}
+
+// Truncate removes all the data from the underlying store.
+func (t *TypedStore[T]) Truncate() error {
+	return t.store.Truncate()
+}
+
+type jsonCodec[T any] struct{}
+
+// JSON returns a Codec that encodes values with encoding/json.
+func JSON[T any]() Codec[T] {
+	return jsonCodec[T]{}
+}
+
+func (jsonCodec[T]) Marshal(value T) ([]byte, error) {
+	return json.Marshal(value)
+}
+
+func (jsonCodec[T]) Unmarshal(data []byte) (T, error) {
+	var value T
+	err := json.Unmarshal(data, &value)
+
+	return value, err
+}
+
+type yamlCodec[T any] struct{}
+
+// YAML returns a Codec that encodes values as YAML, using their JSON struct tags like Kubernetes does.
+func YAML[T any]() Codec[T] {
+	return yamlCodec[T]{}
+}
+
+func (yamlCodec[T]) Marshal(value T) ([]byte, error) {
+	return yaml.Marshal(value)
+}
+
+func (yamlCodec[T]) Unmarshal(data []byte) (T, error) {
+	var value T
+	err := yaml.Unmarshal(data, &value)
+
+	return value, err
+}
+
+type gobCodec[T any] struct{}
+
+// Gob returns a Codec that encodes values with encoding/gob.
+func Gob[T any]() Codec[T] {
+	return gobCodec[T]{}
+}
+
+func (gobCodec[T]) Marshal(value T) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(value); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (gobCodec[T]) Unmarshal(data []byte) (T, error) {
+	var value T
+	err := gob.NewDecoder(bytes.NewReader(data)).Decode(&value)
+
+	return value, err
+}
+
+type protoCodec[T proto.Message] struct{}
+
+// Proto returns a Codec that encodes protocol buffer messages in the binary wire format. T is the pointer type of a
+// generated message, such as *pb.User.
+func Proto[T proto.Message]() Codec[T] {
+	return protoCodec[T]{}
+}
+
+func (protoCodec[T]) Marshal(value T) ([]byte, error) {
+	return proto.Marshal(value)
+}
+
+func (protoCodec[T]) Unmarshal(data []byte) (T, error) {
+	var zero T
+	value := zero.ProtoReflect().New().Interface().(T)
+	err := proto.Unmarshal(data, value)
+
+	return value, err
+}
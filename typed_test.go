@@ -0,0 +1,95 @@
+package mapstore
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+type typedTestUser struct {
+	ID       int64  `json:"id"`
+	UserName string `json:"username"`
+	Email    string `json:"email,omitempty"`
+}
+
+func TestTypedStoreCodecs(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := New(storeTestName, true)
+	assert.NoError(t, err)
+
+	user := typedTestUser{ID: 1234, UserName: "FooBar", Email: "mapstore@example.com"}
+
+	for name, codec := range map[string]Codec[typedTestUser]{
+		"json": JSON[typedTestUser](),
+		"yaml": YAML[typedTestUser](),
+		"gob":  Gob[typedTestUser](),
+	} {
+		users := NewTypedStore[typedTestUser](kv.WithPrefix(name+"."), codec)
+		assert.NoError(t, users.Set("user", user), name)
+
+		got, err := users.Get("user")
+		assert.NoError(t, err, name)
+		assert.Equal(t, user, got, name)
+	}
+
+	raw, err := kv.Get("json.user")
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"id":1234,"username":"FooBar","email":"mapstore@example.com"}`, string(raw))
+
+	raw, err = kv.Get("yaml.user")
+	assert.NoError(t, err)
+	assert.Equal(t, "email: mapstore@example.com\nid: 1234\nusername: FooBar\n", string(raw))
+}
+
+func TestTypedStoreProto(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := New(storeTestName, false)
+	assert.NoError(t, err)
+
+	messages := NewTypedStore(kv, Proto[*wrapperspb.StringValue]())
+	assert.NoError(t, messages.Set("greeting", wrapperspb.String("hello")))
+
+	got, err := messages.Get("greeting")
+	assert.NoError(t, err)
+	assert.Equal(t, "hello", got.GetValue())
+}
+
+func TestTypedStoreErrors(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := New(storeTestName, false)
+	assert.NoError(t, err)
+
+	users := NewTypedStore(kv, JSON[*typedTestUser]())
+
+	_, err = users.Get("missing")
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	assert.NoError(t, kv.Set("broken", []byte("{not json")))
+
+	_, err = users.Get("broken")
+	var decodeErr *DecodeError
+	assert.True(t, errors.As(err, &decodeErr))
+	assert.Equal(t, "broken", decodeErr.Key)
+
+	// Pointer types are allocated when decoding.
+	assert.NoError(t, users.Set("user", &typedTestUser{ID: 1}))
+	got, err := users.Get("user")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), got.ID)
+
+	keys, err := users.Keys()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"broken", "user"}, keys)
+
+	assert.NoError(t, users.Delete("broken"))
+	assert.NoError(t, users.Truncate())
+
+	keys, err = users.Keys()
+	assert.NoError(t, err)
+	assert.Empty(t, keys)
+}
@@ -14,17 +14,17 @@ func VerifyConnection(testMapName string) error {
 	testData := map[string][]byte{key: []byte(val)}
 
 	// Set a value.
-	if err := client.set(testMapName, testData); err != nil {
+	if err := client.set(client.ctx, testMapName, testData); err != nil {
 		return err
 	}
 
 	// Get a value.
-	if data, err := client.get(testMapName); err != nil {
+	if data, err := client.get(client.ctx, testMapName); err != nil {
 		return err
 	} else if dataVal, ok := data["test"]; !ok || string(dataVal) != val {
 		return fmt.Errorf("data is mismatched")
 	}
 
 	// Delete a value.
-	return client.delete(testMapName)
+	return client.delete(client.ctx, testMapName)
 }
@@ -0,0 +1,278 @@
+package mapstore
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// ErrReadOnly is returned by the write methods of a VolumeManager.
+var ErrReadOnly = fmt.Errorf("store is read only")
+
+// volumeDataLink is the symlink the kubelet points at the directory that holds the current keys of a mounted volume.
+const volumeDataLink = "..data"
+
+// volumeReadRetries limits how often a read is retried when the kubelet swaps the data while it is being read.
+const volumeReadRetries = 5
+
+// Verify we meet the requirements for our own interfaces.
+var _ Interface = &VolumeManager{}
+
+// VolumeManager is a read only key value store for a ConfigMap that is mounted as a volume, for pods that can't read
+// the ConfigMap through the API. The keys are read when it is created and again every time the kubelet updates the
+// volume, so reads never touch the file system. Keys and values are decoded and keys expire the same way as with a
+// Manager, but as the volume only holds the ConfigMap itself, values that are encrypted or chunked can't be read.
+type VolumeManager struct {
+	*sync.RWMutex
+	path        string
+	keyEncoding bool
+	compressor  Compressor
+	data        map[string][]byte
+	expiries    expiries
+	watcher     *fsnotify.Watcher
+}
+
+// NewVolume returns a VolumeManager for the volume mounted at the given path, and starts watching it for updates until
+// Close is called. Pass WithKeyEncoding if the ConfigMap was written with it, and WithCompression if it was written
+// with a custom Compressor. Other options are rejected, as they can't apply to a volume. If the volume holds values
+// that are encrypted or chunked, an error is returned.
+func NewVolume(path string, opts ...Option) (*VolumeManager, error) {
+	o := newOptions(opts)
+
+	rest := *o
+	rest.keyEncoding, rest.compressor = false, nil
+	if rest != (options{}) {
+		return nil, fmt.Errorf("a VolumeManager only supports the WithKeyEncoding and WithCompression options")
+	}
+
+	v := &VolumeManager{RWMutex: &sync.RWMutex{}, path: path, keyEncoding: o.keyEncoding, compressor: o.compressor}
+	if err := v.reload(); err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	// The kubelet replaces the ..data symlink in the directory itself, so that is what is watched.
+	if err := watcher.Add(path); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	v.watcher = watcher
+	go v.watch()
+
+	return v, nil
+}
+
+// Keys returns all the key names.
+func (v *VolumeManager) Keys() ([]string, error) {
+	v.RLock()
+	defer v.RUnlock()
+
+	now := timeNow()
+	keys := make([]string, 0, len(v.data))
+	for key := range v.data {
+		if !v.expiries.expired(key, now) {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys, nil
+}
+
+// Get returns the value of the key, or ErrKeyNotFound.
+func (v *VolumeManager) Get(key string) ([]byte, error) {
+	v.RLock()
+	defer v.RUnlock()
+
+	val, ok := v.data[key]
+	if !ok || v.expiries.expired(key, timeNow()) {
+		return nil, ErrKeyNotFound
+	}
+
+	return append([]byte{}, val...), nil
+}
+
+// GetMany looks up all the given keys. Keys that do not exist are left out of the result.
+func (v *VolumeManager) GetMany(keys []string) (map[string][]byte, error) {
+	v.RLock()
+	defer v.RUnlock()
+
+	now := timeNow()
+	result := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		if val, ok := v.data[key]; ok && !v.expiries.expired(key, now) {
+			result[key] = append([]byte{}, val...)
+		}
+	}
+
+	return result, nil
+}
+
+// Raw returns a copy of all the data.
+func (v *VolumeManager) Raw() (map[string][]byte, error) {
+	v.RLock()
+	defer v.RUnlock()
+
+	now := timeNow()
+	result := make(map[string][]byte, len(v.data))
+	for key, val := range v.data {
+		if !v.expiries.expired(key, now) {
+			result[key] = append([]byte{}, val...)
+		}
+	}
+
+	return result, nil
+}
+
+// Set always returns ErrReadOnly.
+func (v *VolumeManager) Set(key string, value []byte) error {
+	return ErrReadOnly
+}
+
+// Delete always returns ErrReadOnly.
+func (v *VolumeManager) Delete(key string) error {
+	return ErrReadOnly
+}
+
+// Truncate always returns ErrReadOnly.
+func (v *VolumeManager) Truncate() error {
+	return ErrReadOnly
+}
+
+// Close stops watching the volume for updates. The data read last stays available.
+func (v *VolumeManager) Close() {
+	v.watcher.Close()
+}
+
+// watch reloads the data on every change to the volume, until the watcher is closed. If the volume can't be read, the
+// data read last is kept.
+func (v *VolumeManager) watch() {
+	for {
+		select {
+		case _, ok := <-v.watcher.Events:
+			if !ok {
+				return
+			}
+
+			_ = v.reload()
+		case _, ok := <-v.watcher.Errors:
+			if !ok {
+				return
+			}
+		}
+	}
+}
+
+// reload reads and decodes the volume, and replaces the data if that works.
+func (v *VolumeManager) reload() error {
+	stored, err := readVolume(v.path)
+	if err != nil {
+		return err
+	}
+
+	// The expiry times are stored like any other value.
+	exp := expiries{}
+	if value, ok := stored[expiryKey]; ok {
+		delete(stored, expiryKey)
+
+		if value, err = v.decodeValue(expiryKey, value); err != nil {
+			return err
+		}
+
+		exp = parseExpiries(value)
+	}
+
+	data := make(map[string][]byte, len(stored))
+	userExp := expiries{}
+
+	for key, value := range stored {
+		if value, err = v.decodeValue(key, value); err != nil {
+			return err
+		}
+
+		userKey := key
+		if v.keyEncoding {
+			userKey = decodeKey(key)
+		}
+
+		data[userKey] = value
+		if at, ok := exp[key]; ok {
+			userExp[userKey] = at
+		}
+	}
+
+	v.Lock()
+	v.data, v.expiries = data, userExp
+	v.Unlock()
+
+	return nil
+}
+
+// decodeValue decompresses a stored value. Encrypted and chunked values are an error, as the volume does not hold what
+// is needed to read them.
+func (v *VolumeManager) decodeValue(key string, value []byte) ([]byte, error) {
+	if bytes.HasPrefix(value, encryptionHeader) {
+		return nil, fmt.Errorf("value of key %q is encrypted, which a VolumeManager can't read", key)
+	}
+
+	if _, ok := parseManifest(value); ok {
+		return nil, fmt.Errorf("value of key %q is chunked, which a VolumeManager can't read", key)
+	}
+
+	return decompress(v.compressor, value)
+}
+
+// readVolume reads the keys of a mounted volume. The kubelet writes every update to a new directory and then swaps the
+// ..data symlink over to it, so the keys are read from the directory it points to, and read again if it was swapped
+// in the meantime. A plain directory without the symlink is read as is.
+func readVolume(path string) (map[string][]byte, error) {
+	link := filepath.Join(path, volumeDataLink)
+
+	for i := 0; ; i++ {
+		target, err := filepath.EvalSymlinks(link)
+		if os.IsNotExist(err) {
+			return readVolumeDir(path)
+		} else if err != nil {
+			return nil, err
+		}
+
+		data, err := readVolumeDir(target)
+		if current, _ := filepath.EvalSymlinks(link); current == target && err == nil {
+			return data, nil
+		}
+
+		if i == volumeReadRetries {
+			if err == nil {
+				err = fmt.Errorf("volume %s kept changing while it was read", path)
+			}
+
+			return nil, err
+		}
+	}
+}
+
+// readVolumeDir reads the keys in the directory along with the expiry metadata, which readKeyFiles skips as its key is
+// reserved.
+func readVolumeDir(dir string) (map[string][]byte, error) {
+	data, err := readKeyFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := os.ReadFile(filepath.Join(dir, expiryKey))
+	if err == nil {
+		data[expiryKey] = value
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	return data, nil
+}
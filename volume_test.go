@@ -0,0 +1,177 @@
+package mapstore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeVolumeUpdate lays out the data the way the kubelet does: the keys are written to a new directory, the ..data
+// symlink is swapped over to it, and the old directory is removed.
+func writeVolumeUpdate(t *testing.T, dir, version string, data map[string]string) {
+	versionDir := filepath.Join(dir, "..2026_10_17_"+version)
+	assert.NoError(t, os.Mkdir(versionDir, 0o755))
+
+	for key, value := range data {
+		assert.NoError(t, os.WriteFile(filepath.Join(versionDir, key), []byte(value), 0o644))
+
+		// The symlinks of the keys point through ..data, and are only created for new keys.
+		link := filepath.Join(dir, key)
+		if _, err := os.Lstat(link); os.IsNotExist(err) {
+			assert.NoError(t, os.Symlink(filepath.Join(volumeDataLink, key), link))
+		}
+	}
+
+	old, _ := os.Readlink(filepath.Join(dir, volumeDataLink))
+
+	tmpLink := filepath.Join(dir, "..data_tmp")
+	assert.NoError(t, os.Symlink(filepath.Base(versionDir), tmpLink))
+	assert.NoError(t, os.Rename(tmpLink, filepath.Join(dir, volumeDataLink)))
+
+	if old != "" {
+		assert.NoError(t, os.RemoveAll(filepath.Join(dir, old)))
+	}
+}
+
+func TestVolumeManager(t *testing.T) {
+	dir := t.TempDir()
+	writeVolumeUpdate(t, dir, "1", map[string]string{"hello": "world", "foo": "bar"})
+
+	v, err := NewVolume(dir)
+	assert.NoError(t, err)
+	defer v.Close()
+
+	val, err := v.Get("hello")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("world"), val)
+
+	_, err = v.Get("missing")
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	keys, err := v.Keys()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"hello", "foo"}, keys)
+
+	many, err := v.GetMany([]string{"foo", "missing"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{"foo": []byte("bar")}, many)
+
+	// Updates are picked up once the kubelet swaps the data.
+	writeVolumeUpdate(t, dir, "2", map[string]string{"hello": "there", "new": "key"})
+
+	assert.Eventually(t, func() bool {
+		raw, err := v.Raw()
+		return err == nil && assert.ObjectsAreEqual(map[string][]byte{"hello": []byte("there"), "new": []byte("key")}, raw)
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// After Close the data read last stays available.
+	v.Close()
+	val, err = v.Get("new")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("key"), val)
+}
+
+func TestVolumeManagerReadOnly(t *testing.T) {
+	v, err := NewVolume(t.TempDir())
+	assert.NoError(t, err)
+	defer v.Close()
+
+	assert.Equal(t, ErrReadOnly, v.Set("hello", []byte("world")))
+	assert.Equal(t, ErrReadOnly, v.Delete("hello"))
+	assert.Equal(t, ErrReadOnly, v.Truncate())
+}
+
+func TestVolumeManagerPlainDirectory(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "hello"), []byte("world"), 0o644))
+
+	v, err := NewVolume(dir)
+	assert.NoError(t, err)
+	defer v.Close()
+
+	val, err := v.Get("hello")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("world"), val)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "hello"), []byte("there"), 0o644))
+
+	assert.Eventually(t, func() bool {
+		val, err := v.Get("hello")
+		return err == nil && string(val) == "there"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	_, err = NewVolume(filepath.Join(dir, "missing"))
+	assert.Error(t, err)
+}
+
+func TestVolumeManagerDecoding(t *testing.T) {
+	setFakeKubeClient(t)
+	now := setFakeTime(t)
+
+	// Write the ConfigMap with a Manager, and mount what it stored.
+	kv, err := NewWithOptions(storeTestName, WithKeyEncoding())
+	assert.NoError(t, err)
+	assert.NoError(t, kv.Set("user/42", []byte("alice")))
+	assert.NoError(t, kv.Set("header", []byte("\x00mszlooks compressed")))
+	assert.NoError(t, kv.SetWithTTL("lease", []byte("holder"), time.Minute))
+
+	stored, err := kv.client.get(kv.ctx, storeTestName)
+	assert.NoError(t, err)
+
+	files := map[string]string{}
+	for key, value := range stored {
+		files[key] = string(value)
+	}
+
+	dir := t.TempDir()
+	writeVolumeUpdate(t, dir, "1", files)
+
+	v, err := NewVolume(dir, WithKeyEncoding())
+	assert.NoError(t, err)
+	defer v.Close()
+
+	raw, err := v.Raw()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{
+		"user/42": []byte("alice"),
+		"header":  []byte("\x00mszlooks compressed"),
+		"lease":   []byte("holder"),
+	}, raw)
+
+	// Keys expire like they do in the Manager.
+	*now = now.Add(time.Minute)
+
+	_, err = v.Get("lease")
+	assert.Equal(t, ErrKeyNotFound, err)
+
+	keys, err := v.Keys()
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"user/42", "header"}, keys)
+}
+
+func TestVolumeManagerUnsupported(t *testing.T) {
+	setFakeKubeClient(t)
+
+	// Encrypted values can't be read without the KeyProvider, which a volume doesn't support.
+	kv, err := NewWithOptions(storeTestName, WithEncryption(testKeyProvider(t, "new")))
+	assert.NoError(t, err)
+	assert.NoError(t, kv.Set("token", []byte("s3cr3t")))
+
+	stored, err := kv.client.get(kv.ctx, storeTestName)
+	assert.NoError(t, err)
+
+	dir := t.TempDir()
+	writeVolumeUpdate(t, dir, "1", map[string]string{"token": string(stored["token"])})
+
+	_, err = NewVolume(dir)
+	assert.Error(t, err)
+
+	_, err = NewVolume(t.TempDir(), WithEncryption(testKeyProvider(t, "new")))
+	assert.Error(t, err)
+
+	_, err = NewVolume(t.TempDir(), WithChunking(DefaultChunkSize))
+	assert.Error(t, err)
+}
@@ -0,0 +1,205 @@
+package mapstore
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// EventType describes the kind of change an Event reports.
+type EventType string
+
+const (
+	// EventPut is sent when a key is created or its value changes.
+	EventPut EventType = "PUT"
+	// EventDelete is sent when a key is removed.
+	EventDelete EventType = "DELETE"
+	// EventError is sent when the new value of a key can not be decoded, for example because it is corrupt or was
+	// encrypted with an unknown key. The key keeps its previous value until it can be decoded again.
+	EventError EventType = "ERROR"
+)
+
+// watchRetryInterval is how long Watch waits before trying again when the watch can not be re-established.
+var watchRetryInterval = time.Second
+
+// Event describes a change to a single key. OldValue is nil for new keys and Value is nil for deleted keys. Err is only
+// set for EventError.
+type Event struct {
+	Type     EventType
+	Key      string
+	OldValue []byte
+	Value    []byte
+	Err      error
+}
+
+// Watch sends an Event for every change to a key starting with keyOrPrefix (an empty string matches every key).
+// Changes are found by comparing the decoded values of each new version of the ConfigMap with the previous one. Values
+// that can't be decoded are reported with an EventError. The returned channel is closed once ctx is done.
+func (k *Manager) Watch(ctx context.Context, keyOrPrefix string) (<-chan Event, error) {
+	stored, w, err := k.startWatch(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan Event)
+	go k.watchLoop(ctx, k.storedKey(keyOrPrefix), stored, w, events)
+
+	return events, nil
+}
+
+// startWatch reads the current live data, still encoded, and starts watching for changes made after it.
+func (k *Manager) startWatch(ctx context.Context) (map[string][]byte, watch.Interface, error) {
+	var resourceVersion string
+	data := map[string][]byte{}
+
+	obj, err := k.store.get(ctx, k.configMapName)
+	if err == nil {
+		resourceVersion = obj.getResourceVersion()
+		data = obj.getData()
+	} else if !isNotFound(err) {
+		return nil, nil, err
+	}
+
+	w, err := k.store.watch(ctx, k.configMapName, resourceVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return k.liveData(ctx, data), w, nil
+}
+
+func (k *Manager) watchLoop(ctx context.Context, prefix string, stored map[string][]byte, w watch.Interface, events chan<- Event) {
+	defer close(events)
+
+	// The stored values that failed to decode, so each of them is only reported once.
+	failed := map[string][]byte{}
+	data, pending := k.decodeWatchData(ctx, stored, nil, failed)
+
+	for {
+		for _, event := range pending {
+			if !strings.HasPrefix(event.Key, prefix) {
+				continue
+			}
+
+			event.Key = k.userKey(event.Key)
+
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				w.Stop()
+				return
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			w.Stop()
+			return
+		case ev, ok := <-w.ResultChan():
+			switch {
+			case !ok || ev.Type == watch.Error:
+				// The watch expired or failed, so start over and catch up on anything we missed.
+				w.Stop()
+				if stored, w = k.restartWatch(ctx); w == nil {
+					return
+				}
+			case ev.Type == watch.Deleted:
+				stored = map[string][]byte{}
+			default:
+				obj, ok := k.store.convert(ev.Object)
+				if !ok || obj.getName() != k.configMapName {
+					pending = nil
+					continue
+				}
+
+				stored = k.liveData(ctx, obj.getData())
+			}
+
+			current, errEvents := k.decodeWatchData(ctx, stored, data, failed)
+			pending = append(errEvents, diffData(prefix, data, current)...)
+			data = current
+		}
+	}
+}
+
+// decodeWatchData decodes the live data of a new version of the ConfigMap. A value that fails to decode keeps its
+// previous decoded value and is returned as an EventError, unless the same stored value already failed before.
+func (k *Manager) decodeWatchData(ctx context.Context, stored, previous, failed map[string][]byte) (map[string][]byte, []Event) {
+	var events []Event
+
+	data := make(map[string][]byte, len(stored))
+	for key, value := range stored {
+		decoded, err := k.decodeValue(ctx, key, value)
+		if err == nil {
+			delete(failed, key)
+			data[key] = decoded
+			continue
+		}
+
+		if ogValue, ok := previous[key]; ok {
+			data[key] = ogValue
+		}
+
+		if ogFailed, ok := failed[key]; ok && bytes.Equal(ogFailed, value) {
+			continue
+		}
+
+		failed[key] = value
+		events = append(events, Event{Type: EventError, Key: key, OldValue: previous[key], Err: err})
+	}
+
+	for key := range failed {
+		if _, ok := stored[key]; !ok {
+			delete(failed, key)
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].Key < events[j].Key })
+
+	return data, events
+}
+
+// restartWatch keeps trying to start a new watch until it works or ctx is done, in which case the watch is nil. The
+// data is returned like startWatch does.
+func (k *Manager) restartWatch(ctx context.Context) (map[string][]byte, watch.Interface) {
+	for {
+		if data, w, err := k.startWatch(ctx); err == nil {
+			return data, w
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, nil
+		case <-time.After(watchRetryInterval):
+		}
+	}
+}
+
+// diffData returns the events that turn the old data into the new data for keys starting with prefix, sorted by key.
+func diffData(prefix string, old, new map[string][]byte) []Event {
+	var events []Event
+
+	for key, value := range new {
+		if !strings.HasPrefix(key, prefix) {
+			continue
+		}
+
+		if ogValue, ok := old[key]; !ok || !bytes.Equal(ogValue, value) {
+			events = append(events, Event{Type: EventPut, Key: key, OldValue: ogValue, Value: value})
+		}
+	}
+
+	for key, ogValue := range old {
+		if _, ok := new[key]; !ok && strings.HasPrefix(key, prefix) {
+			events = append(events, Event{Type: EventDelete, Key: key, OldValue: ogValue})
+		}
+	}
+
+	sort.Slice(events, func(i, j int) bool { return events[i].Key < events[j].Key })
+
+	return events
+}
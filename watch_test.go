@@ -0,0 +1,107 @@
+package mapstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func nextEvent(t *testing.T, events <-chan Event) Event {
+	t.Helper()
+
+	select {
+	case ev := <-events:
+		return ev
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for event")
+		return Event{}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := New(storeTestName, true)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	events, err := kv.Watch(ctx, "flag.")
+	assert.NoError(t, err)
+
+	assert.NoError(t, kv.Set("other", []byte("ignored")))
+	assert.NoError(t, kv.Set("flag.a", []byte("on")))
+	assert.Equal(t, Event{Type: EventPut, Key: "flag.a", Value: []byte("on")}, nextEvent(t, events))
+
+	assert.NoError(t, kv.Set("flag.a", []byte("off")))
+	assert.Equal(t, Event{Type: EventPut, Key: "flag.a", OldValue: []byte("on"), Value: []byte("off")}, nextEvent(t, events))
+
+	assert.NoError(t, kv.Delete("flag.a"))
+	assert.Equal(t, Event{Type: EventDelete, Key: "flag.a", OldValue: []byte("off")}, nextEvent(t, events))
+
+	// The channel is closed once the context is done.
+	cancel()
+	assert.Eventually(t, func() bool {
+		_, ok := <-events
+		return !ok
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestWatchConfigMapDeleted(t *testing.T) {
+	setFakeKubeClient(t)
+
+	kv, err := New(storeTestName, false)
+	assert.NoError(t, err)
+	assert.NoError(t, kv.SetMany(map[string][]byte{"k1": []byte("v1"), "k2": []byte("v2")}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events, err := kv.Watch(ctx, "")
+	assert.NoError(t, err)
+
+	assert.NoError(t, kv.client.delete(kv.ctx, storeTestName))
+	assert.Equal(t, Event{Type: EventDelete, Key: "k1", OldValue: []byte("v1")}, nextEvent(t, events))
+	assert.Equal(t, Event{Type: EventDelete, Key: "k2", OldValue: []byte("v2")}, nextEvent(t, events))
+}
+
+func TestWatchDecodeError(t *testing.T) {
+	setFakeKubeClient(t)
+
+	encrypted, err := NewWithOptions(storeTestName, WithEncryption(testKeyProvider(t, "new")))
+	assert.NoError(t, err)
+	plain, err := New(storeTestName, false)
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	events, err := plain.Watch(ctx, "")
+	assert.NoError(t, err)
+
+	// A value the watcher can't decrypt is reported instead of skipped.
+	assert.NoError(t, encrypted.Set("token", []byte("s3cr3t")))
+	ev := nextEvent(t, events)
+	assert.Equal(t, EventError, ev.Type)
+	assert.Equal(t, "token", ev.Key)
+	assert.True(t, errors.Is(ev.Err, ErrDecryptionFailed))
+
+	// But only once.
+	assert.NoError(t, plain.Set("other", []byte("value")))
+	assert.Equal(t, Event{Type: EventPut, Key: "other", Value: []byte("value")}, nextEvent(t, events))
+}
+
+func TestWatchDiffData(t *testing.T) {
+	old := map[string][]byte{"a": []byte("1"), "b": []byte("2"), "c": []byte("3")}
+	new := map[string][]byte{"a": []byte("1"), "b": []byte("two"), "d": []byte("4")}
+
+	assert.Equal(t, []Event{
+		{Type: EventPut, Key: "b", OldValue: []byte("2"), Value: []byte("two")},
+		{Type: EventDelete, Key: "c", OldValue: []byte("3")},
+		{Type: EventPut, Key: "d", Value: []byte("4")},
+	}, diffData("", old, new))
+
+	assert.Empty(t, diffData("x", old, new))
+}